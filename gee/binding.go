@@ -0,0 +1,436 @@
+package gee
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 常用的 Content-Type
+const (
+	MIMEJSON              = "application/json"
+	MIMEHTML              = "text/html"
+	MIMEXML               = "application/xml"
+	MIMEXML2              = "text/xml"
+	MIMEPlain             = "text/plain"
+	MIMEYAML              = "application/x-yaml"
+	MIMEPOSTForm          = "application/x-www-form-urlencoded"
+	MIMEMultipartPOSTForm = "multipart/form-data"
+)
+
+// defaultMultipartMemory 解析 multipart 表单时 内存中最多保存的字节数 超出的部分写入临时文件
+const defaultMultipartMemory = 32 << 20 // 32 MB
+
+// Binding
+// @Description: 将请求中的数据绑定到结构体上
+type Binding interface {
+	Name() string
+	Bind(req *http.Request, obj interface{}) error
+}
+
+// 内置的 Binding
+var (
+	BindingJSON   Binding = jsonBinding{}
+	BindingXML    Binding = xmlBinding{}
+	BindingForm   Binding = formBinding{}
+	BindingQuery  Binding = queryBinding{}
+	BindingHeader Binding = headerBinding{}
+)
+
+// validate
+// @Description: 使用 Validator 校验绑定后的结构体
+// @param obj
+// @return error
+func validate(obj interface{}) error {
+	if Validator == nil {
+		return nil
+	}
+	return Validator.ValidateStruct(obj)
+}
+
+// bindingFor
+// @Description: 根据请求方法和 Content-Type 选择 Binding
+// @param method
+// @param contentType
+// @return Binding
+func bindingFor(method string, contentType string) Binding {
+	if method == http.MethodGet {
+		return BindingForm
+	}
+	switch contentType {
+	case MIMEJSON:
+		return BindingJSON
+	case MIMEXML, MIMEXML2:
+		return BindingXML
+	default:
+		return BindingForm
+	}
+}
+
+type jsonBinding struct{}
+
+func (jsonBinding) Name() string {
+	return "json"
+}
+
+func (jsonBinding) Bind(req *http.Request, obj interface{}) error {
+	if req == nil || req.Body == nil {
+		return errors.New("gee: invalid request")
+	}
+	return json.NewDecoder(req.Body).Decode(obj)
+}
+
+type xmlBinding struct{}
+
+func (xmlBinding) Name() string {
+	return "xml"
+}
+
+func (xmlBinding) Bind(req *http.Request, obj interface{}) error {
+	if req == nil || req.Body == nil {
+		return errors.New("gee: invalid request")
+	}
+	return xml.NewDecoder(req.Body).Decode(obj)
+}
+
+// formBinding 绑定 Query String 与表单 使用 form 标签
+type formBinding struct{}
+
+func (formBinding) Name() string {
+	return "form"
+}
+
+func (formBinding) Bind(req *http.Request, obj interface{}) error {
+	if strings.HasPrefix(req.Header.Get("Content-Type"), MIMEMultipartPOSTForm) {
+		if err := req.ParseMultipartForm(defaultMultipartMemory); err != nil {
+			return err
+		}
+	} else if err := req.ParseForm(); err != nil {
+		return err
+	}
+	return mapForm(obj, formSource(req.Form), "form")
+}
+
+// queryBinding 只绑定 Query String 使用 form 标签
+type queryBinding struct{}
+
+func (queryBinding) Name() string {
+	return "query"
+}
+
+func (queryBinding) Bind(req *http.Request, obj interface{}) error {
+	return mapForm(obj, formSource(req.URL.Query()), "form")
+}
+
+// headerBinding 绑定请求头 使用 header 标签
+type headerBinding struct{}
+
+func (headerBinding) Name() string {
+	return "header"
+}
+
+func (headerBinding) Bind(req *http.Request, obj interface{}) error {
+	return mapForm(obj, headerSource(req.Header), "header")
+}
+
+// valueSource 按名称查找待绑定的值
+type valueSource interface {
+	lookup(key string) ([]string, bool)
+}
+
+type formSource map[string][]string
+
+func (s formSource) lookup(key string) ([]string, bool) {
+	values, ok := s[key]
+	return values, ok
+}
+
+type headerSource map[string][]string
+
+func (s headerSource) lookup(key string) ([]string, bool) {
+	values, ok := s[textproto.CanonicalMIMEHeaderKey(key)]
+	return values, ok
+}
+
+// paramsSource 路由参数
+type paramsSource Params
+
+func (s paramsSource) lookup(key string) ([]string, bool) {
+	if value, ok := Params(s).Get(key); ok {
+		return []string{value}, true
+	}
+	return nil, false
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// mapForm
+// @Description: 使用反射将 source 中的值按结构体标签写入 obj
+// @PS: 支持 string、整数、浮点数、bool、time.Time、time.Duration、切片、指针、嵌套结构体 以及实现了 encoding.TextUnmarshaler 的类型
+// @PS: 标签格式为 `form:"name,default=1"` 标签为 - 时忽略该字段 没有标签时使用字段名
+// @param obj	结构体指针
+// @param source
+// @param tag	使用的标签名 form、uri、header
+// @return error
+func mapForm(obj interface{}, source valueSource, tag string) error {
+	value := reflect.ValueOf(obj)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("gee: bind target must be a non-nil pointer, got %T", obj)
+	}
+	value = value.Elem()
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("gee: bind target must point to a struct, got %T", obj)
+	}
+	_, err := mapStruct(value, source, tag, map[reflect.Type]bool{})
+	return err
+}
+
+// mapStruct
+// @Description: 逐个绑定结构体的字段
+// @param visited	当前展开路径上的结构体类型 用于避免自引用类型无限展开
+// @return bool 是否有字段被设置
+// @return error
+func mapStruct(value reflect.Value, source valueSource, tag string, visited map[reflect.Type]bool) (bool, error) {
+	typ := value.Type()
+	visited[typ] = true
+	defer delete(visited, typ)
+	isSet := false
+	for i := 0; i < typ.NumField(); i++ {
+		// 跳过未导出的字段 未导出的匿名结构体中导出的字段依然可以设置
+		field, fieldValue := typ.Field(i), value.Field(i)
+		if !fieldValue.CanSet() && !(field.Anonymous && fieldValue.Kind() == reflect.Struct) {
+			continue
+		}
+		ok, err := mapField(fieldValue, field, source, tag, visited)
+		if err != nil {
+			return false, err
+		}
+		isSet = isSet || ok
+	}
+	return isSet, nil
+}
+
+// mapField
+// @Description: 绑定单个字段
+// @param value
+// @param field
+// @param source
+// @param tag
+// @param visited
+// @return bool 是否设置了值
+// @return error
+func mapField(value reflect.Value, field reflect.StructField, source valueSource, tag string, visited map[reflect.Type]bool) (bool, error) {
+	tagValue := field.Tag.Get(tag)
+	if tagValue == "-" {
+		return false, nil
+	}
+	name, opts := tagValue, ""
+	if i := strings.IndexByte(tagValue, ','); i >= 0 {
+		name, opts = tagValue[:i], tagValue[i+1:]
+	}
+
+	// 没有标签的结构体字段(包括匿名字段) 展开绑定其内部字段
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	if name == "" && fieldType.Kind() == reflect.Struct && fieldType != timeType && !isTextUnmarshaler(fieldType) {
+		if value.Kind() != reflect.Ptr {
+			return mapStruct(value, source, tag, visited)
+		}
+		// 自引用的结构体指针(如链表节点)不再展开 否则会无限递归
+		if visited[fieldType] {
+			return false, nil
+		}
+		// 结构体指针只有在内部字段被设置时才分配
+		elem := reflect.New(fieldType)
+		isSet, err := mapStruct(elem.Elem(), source, tag, visited)
+		if isSet && err == nil {
+			value.Set(elem)
+		}
+		return isSet, err
+	}
+
+	if name == "" {
+		name = field.Name
+	}
+	values, ok := source.lookup(name)
+	if !ok || len(values) == 0 {
+		defaultValue := tagOption(opts, "default")
+		if defaultValue == "" {
+			return false, nil
+		}
+		values = []string{defaultValue}
+	}
+	if err := setValues(value, field, values); err != nil {
+		return false, fmt.Errorf("gee: bind field %s: %w", field.Name, err)
+	}
+	return true, nil
+}
+
+// tagOption 读取标签中 key=value 形式的选项
+func tagOption(opts string, key string) string {
+	for _, opt := range strings.Split(opts, ",") {
+		if strings.HasPrefix(opt, key+"=") {
+			return opt[len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// isTextUnmarshaler 类型的指针是否实现了 encoding.TextUnmarshaler
+func isTextUnmarshaler(typ reflect.Type) bool {
+	return reflect.PtrTo(typ).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+// setValues 将一组字符串写入字段 切片和数组使用全部的值 其余类型使用第一个值
+func setValues(value reflect.Value, field reflect.StructField, values []string) error {
+	switch value.Kind() {
+	case reflect.Slice:
+		if isTextUnmarshaler(value.Type()) {
+			break
+		}
+		slice := reflect.MakeSlice(value.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), field, s); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	case reflect.Array:
+		if len(values) != value.Len() {
+			return fmt.Errorf("%q is not valid value for %s", values, value.Type())
+		}
+		for i, s := range values {
+			if err := setValue(value.Index(i), field, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setValue(value, field, values[0])
+}
+
+// setValue 将字符串转换为字段的类型后写入
+func setValue(value reflect.Value, field reflect.StructField, s string) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return setValue(value.Elem(), field, s)
+	}
+	// time.Time 也实现了 encoding.TextUnmarshaler 需要先处理以支持 time_format
+	switch value.Type() {
+	case timeType:
+		return setTime(value, field, s)
+	case durationType:
+		if s == "" {
+			s = "0"
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+	if value.CanAddr() {
+		if u, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		if s == "" {
+			s = "false"
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			s = "0"
+		}
+		i, err := strconv.ParseInt(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			s = "0"
+		}
+		u, err := strconv.ParseUint(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			s = "0"
+		}
+		f, err := strconv.ParseFloat(s, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// setTime
+// @Description: 解析时间 格式由 time_format 标签指定 默认为 RFC3339
+// @PS: time_format 为 unix 或 unixnano 时按时间戳解析 time_utc:"1" 时使用 UTC 时区
+func setTime(value reflect.Value, field reflect.StructField, s string) error {
+	if s == "" {
+		value.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+
+	format := field.Tag.Get("time_format")
+	switch format {
+	case "unix", "unixnano":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		t := time.Unix(n, 0)
+		if format == "unixnano" {
+			t = time.Unix(0, n)
+		}
+		value.Set(reflect.ValueOf(t))
+		return nil
+	case "":
+		format = time.RFC3339
+	}
+
+	loc := time.Local
+	if utc, _ := strconv.ParseBool(field.Tag.Get("time_utc")); utc {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(format, s, loc)
+	if err != nil {
+		return err
+	}
+	value.Set(reflect.ValueOf(t))
+	return nil
+}
@@ -0,0 +1,133 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindPage struct {
+	Page int `form:"page,default=1"`
+	Size int `form:"size,default=20"`
+}
+
+type bindQuery struct {
+	bindPage
+	Name     string        `form:"name"`
+	IDs      []int64       `form:"ids"`
+	Active   *bool         `form:"active"`
+	Birthday time.Time     `form:"birthday" time_format:"2006-01-02" time_utc:"1"`
+	Timeout  time.Duration `form:"timeout"`
+	Ignored  string        `form:"-"`
+}
+
+func TestBindQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet,
+		"/users?name=geektutu&ids=1&ids=2&active=true&birthday=2019-08-17&timeout=3s&page=2&Ignored=x", nil)
+	c := &Context{Req: req, Method: req.Method}
+
+	var q bindQuery
+	if err := c.Bind(&q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Name != "geektutu" || len(q.IDs) != 2 || q.IDs[1] != 2 || q.Active == nil || !*q.Active {
+		t.Fatalf("unexpected result %+v", q)
+	}
+	if !q.Birthday.Equal(time.Date(2019, 8, 17, 0, 0, 0, 0, time.UTC)) || q.Timeout != 3*time.Second {
+		t.Fatalf("unexpected time fields %v %v", q.Birthday, q.Timeout)
+	}
+	if q.Page != 2 || q.Size != 20 || q.Ignored != "" {
+		t.Fatalf("unexpected embedded or ignored fields %+v", q)
+	}
+
+	var bad bindQuery
+	c.Req = httptest.NewRequest(http.MethodGet, "/users?ids=a", nil)
+	if err := c.BindQuery(&bad); err == nil {
+		t.Fatal("invalid integer should fail")
+	}
+}
+
+type bindNode struct {
+	Name string `form:"name"`
+	Next *bindNode
+}
+
+func TestBindSelfReferential(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/nodes?name=a", nil)
+	c := &Context{Req: req, Method: req.Method}
+
+	var node bindNode
+	if err := c.BindQuery(&node); err != nil {
+		t.Fatal(err)
+	}
+	if node.Name != "a" || node.Next != nil {
+		t.Fatalf("unexpected result %+v", node)
+	}
+}
+
+func TestBindBody(t *testing.T) {
+	type login struct {
+		Username string `json:"username" xml:"username" form:"username"`
+		Password string `json:"password" xml:"password" form:"password"`
+	}
+	tests := []struct {
+		contentType, body string
+	}{
+		{MIMEJSON + "; charset=utf-8", `{"username":"gee","password":"123"}`},
+		{MIMEXML, `<login><username>gee</username><password>123</password></login>`},
+		{MIMEPOSTForm, url.Values{"username": {"gee"}, "password": {"123"}}.Encode()},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		c := &Context{Req: req, Method: req.Method}
+		var l login
+		if err := c.Bind(&l); err != nil {
+			t.Fatalf("%s: %v", tt.contentType, err)
+		}
+		if l.Username != "gee" || l.Password != "123" {
+			t.Fatalf("%s: unexpected result %+v", tt.contentType, l)
+		}
+	}
+}
+
+func TestBindURIAndHeader(t *testing.T) {
+	r := New()
+	r.GET("/repos/:owner/:id", func(c *Context) {
+		var uri struct {
+			Owner string `uri:"owner"`
+			ID    uint   `uri:"id"`
+		}
+		var header struct {
+			RequestID string `header:"x-request-id"`
+			Retry     int    `header:"X-Retry"`
+		}
+		if err := c.BindURI(&uri); err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := c.BindHeader(&header); err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%s %d %s %d", uri.Owner, uri.ID, header.RequestID, header.Retry)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/repos/geektutu/7", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	req.Header.Set("X-Retry", "3")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "geektutu 7 abc 3" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/repos/geektutu/x", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid uri param should fail, got %d", w.Code)
+	}
+}
@@ -1,23 +1,72 @@
 package gee
 
 import (
-	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 type H map[string]interface{}
 
+// MarshalXML
+// @Description: 将 H 编码为 XML 每个键对应一个子元素 按键排序保证输出稳定
+// @PS: 使 c.XML、c.Negotiate 可以和 JSON 一样直接使用 H
+// @receiver h
+// @param e
+// @param start	根元素 顶层编码时为 <H>
+// @return error
+func (h H) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := e.EncodeElement(h[key], xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// abortIndex Abort 之后 index 被设置为该值 远大于处理链的长度 嵌套的 Next 在此基础上自增也不会回到处理链中
+const abortIndex int = math.MaxInt32 / 2
+
 type Context struct {
 	// 原始对象
-	Writer http.ResponseWriter
-	Req    *http.Request
+	writermem responseWriter
+	Writer    ResponseWriter
+	Req       *http.Request
 	// 请求信息
 	Path   string
 	Method string
-	Params map[string]string
-	// 响应信息
+	Params Params
+	// StatusCode 响应状态码 与 Writer.Status() 保持一致 在 Status 以及每个处理器返回后更新
 	StatusCode int
+	// Errors 处理过程中记录的错误 例如 AbortWithError
+	Errors []error
+	// Keys 请求级别的键值存储 用于在中间件和处理器之间传递数据
+	Keys map[string]interface{}
+	mu   sync.RWMutex // 保护 Keys
+	// 缓存解析后的 Query String 和表单 避免每次取值都重新解析
+	queryCache url.Values
+	formCache  url.Values
 	// middleware
 	handlers []HandlerFunc
 	index    int // index 记录当前执行到的中间件的索引
@@ -26,18 +75,238 @@ type Context struct {
 }
 
 func (c *Context) Param(key string) string {
-	value, _ := c.Params[key]
-	return value
+	return c.Params.ByName(key)
+}
+
+// reset
+// @Description: 重置 Context 以便从对象池中复用
+// @PS: Params 只截断不释放 复用已经分配的内存
+// @receiver c
+// @param w
+// @param req
+func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
+	c.writermem.reset(w)
+	c.Writer = &c.writermem
+	c.Req = req
+	c.Path = req.URL.Path
+	c.Method = req.Method
+	c.Params = c.Params[:0]
+	c.StatusCode = c.writermem.Status()
+	c.Errors = c.Errors[:0]
+	c.Keys = nil
+	c.queryCache = nil
+	c.formCache = nil
+	c.handlers = nil
+	c.index = -1
+}
+
+// Copy
+// @Description: 复制当前 Context 用于在 goroutine 中使用
+// @PS: 请求结束后 Context 会被放回对象池复用 处理器返回后仍需使用时 必须使用副本
+// @PS: 副本只能用于读取请求信息 不能写入响应 也不能调用 Next
+// @receiver c
+// @return *Context
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		writermem:  c.writermem,
+		Req:        c.Req,
+		Path:       c.Path,
+		Method:     c.Method,
+		StatusCode: c.StatusCode,
+		engine:     c.engine,
+		index:      abortIndex,
+	}
+	cp.writermem.ResponseWriter = nil
+	cp.Writer = &cp.writermem
+	cp.Params = make(Params, len(c.Params))
+	copy(cp.Params, c.Params)
+	cp.Errors = append([]error(nil), c.Errors...)
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return cp
+}
+
+// Set
+// @Description: 在 Context 中保存一个键值对 例如认证中间件保存当前用户 后续的处理器通过 Get 获取
+// @receiver c
+// @param key
+// @param value
+func (c *Context) Set(key string, value interface{}) {
+	c.mu.Lock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+	c.mu.Unlock()
+}
+
+// Get
+// @Description: 获取 Set 保存的值
+// @receiver c
+// @param key
+// @return value
+// @return exists	键是否存在
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	value, exists = c.Keys[key]
+	c.mu.RUnlock()
+	return
+}
+
+// MustGet
+// @Description: 获取 Set 保存的值 键不存在时 panic
+// @receiver c
+// @param key
+// @return interface{}
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic(fmt.Sprintf("gee: key \"%s\" does not exist", key))
+}
+
+// 以下方法获取指定类型的值 键不存在或类型不匹配时返回零值
+
+func (c *Context) GetString(key string) (s string) {
+	if value, ok := c.Get(key); ok && value != nil {
+		s, _ = value.(string)
+	}
+	return
+}
+
+func (c *Context) GetBool(key string) (b bool) {
+	if value, ok := c.Get(key); ok && value != nil {
+		b, _ = value.(bool)
+	}
+	return
 }
 
-func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	return &Context{
-		Writer: w,
-		Req:    req,
-		Path:   req.URL.Path,
-		Method: req.Method,
-		index:  -1,
+func (c *Context) GetInt(key string) (i int) {
+	if value, ok := c.Get(key); ok && value != nil {
+		i, _ = value.(int)
 	}
+	return
+}
+
+func (c *Context) GetInt64(key string) (i64 int64) {
+	if value, ok := c.Get(key); ok && value != nil {
+		i64, _ = value.(int64)
+	}
+	return
+}
+
+func (c *Context) GetUint(key string) (ui uint) {
+	if value, ok := c.Get(key); ok && value != nil {
+		ui, _ = value.(uint)
+	}
+	return
+}
+
+func (c *Context) GetUint64(key string) (ui64 uint64) {
+	if value, ok := c.Get(key); ok && value != nil {
+		ui64, _ = value.(uint64)
+	}
+	return
+}
+
+func (c *Context) GetFloat64(key string) (f64 float64) {
+	if value, ok := c.Get(key); ok && value != nil {
+		f64, _ = value.(float64)
+	}
+	return
+}
+
+func (c *Context) GetTime(key string) (t time.Time) {
+	if value, ok := c.Get(key); ok && value != nil {
+		t, _ = value.(time.Time)
+	}
+	return
+}
+
+func (c *Context) GetDuration(key string) (d time.Duration) {
+	if value, ok := c.Get(key); ok && value != nil {
+		d, _ = value.(time.Duration)
+	}
+	return
+}
+
+func (c *Context) GetStringSlice(key string) (ss []string) {
+	if value, ok := c.Get(key); ok && value != nil {
+		ss, _ = value.([]string)
+	}
+	return
+}
+
+func (c *Context) GetStringMap(key string) (sm map[string]interface{}) {
+	if value, ok := c.Get(key); ok && value != nil {
+		sm, _ = value.(map[string]interface{})
+	}
+	return
+}
+
+func (c *Context) GetStringMapString(key string) (sms map[string]string) {
+	if value, ok := c.Get(key); ok && value != nil {
+		sms, _ = value.(map[string]string)
+	}
+	return
+}
+
+// 以下方法实现 context.Context 接口 handler 可以直接把 c 传给数据库等需要 context.Context 的调用
+
+// Deadline
+// @Description: 返回请求的截止时间 委托给 c.Req.Context()
+// @PS: Context 会在请求结束后被复用 不要在处理器返回后继续把 c 当作 context.Context 使用 需要时使用 c.Copy()
+// @receiver c
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Req == nil {
+		return
+	}
+	return c.Req.Context().Deadline()
+}
+
+// Done
+// @Description: 客户端断开连接或请求超时时关闭 委托给 c.Req.Context()
+// @receiver c
+// @return <-chan struct{}
+func (c *Context) Done() <-chan struct{} {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Done()
+}
+
+// Err
+// @Description: Done 关闭后返回关闭的原因 委托给 c.Req.Context()
+// @receiver c
+// @return error
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+// Value
+// @Description: 字符串类型的 key 优先从 Keys 中查找 其余的委托给 c.Req.Context()
+// @receiver c
+// @param key
+// @return interface{}
+func (c *Context) Value(key interface{}) interface{} {
+	if keyAsString, ok := key.(string); ok {
+		if value, exists := c.Get(keyAsString); exists {
+			return value
+		}
+	}
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Value(key)
 }
 
 // Next
@@ -48,34 +317,378 @@ func (c *Context) Next() {
 	s := len(c.handlers)
 	for ; c.index < s; c.index++ {
 		c.handlers[c.index](c)
+		// 处理器可能绕过 Status 直接写入 Writer 例如 http.ServeContent
+		c.StatusCode = c.Writer.Status()
+	}
+}
+
+// Abort
+// @Description: 中止处理链 当前处理器之后的处理器都不会再执行 当前处理器本身会继续执行完毕
+// @PS: 不会写入响应 需要响应时使用 AbortWithStatus 等方法
+// @receiver c
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted
+// @Description: 处理链是否已经中止
+// @receiver c
+// @return bool
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus
+// @Description: 中止处理链并写入状态码
+// @receiver c
+// @param code
+func (c *Context) AbortWithStatus(code int) {
+	c.Status(code)
+	c.Abort()
+}
+
+// AbortWithStatusJSON
+// @Description: 中止处理链并返回 JSON
+// @receiver c
+// @param code
+// @param obj
+func (c *Context) AbortWithStatusJSON(code int, obj interface{}) {
+	c.Abort()
+	c.JSON(code, obj)
+}
+
+// AbortWithError
+// @Description: 中止处理链并写入状态码 错误记录到 c.Errors 中 交给之前的中间件统一处理
+// @receiver c
+// @param code
+// @param err
+// @return error 返回传入的 err 便于链式处理
+func (c *Context) AbortWithError(code int, err error) error {
+	c.Errors = append(c.Errors, err)
+	c.AbortWithStatus(code)
+	return err
+}
+
+// initFormCache 解析请求体中的表单 multipart 表单同样会被解析
+// 解析失败时错误记录到 c.Errors 中 请求体超出 BodyLimit 时为 ErrBodyTooLarge
+func (c *Context) initFormCache() {
+	if c.formCache != nil {
+		return
+	}
+	err := c.Req.ParseMultipartForm(c.maxMultipartMemory())
+	// 非 multipart 请求体的解析错误会被 ErrNotMultipart 覆盖 需要单独检查是否超出限制
+	if bodyTooLarge(c.Req) {
+		err = ErrBodyTooLarge
+	}
+	if err != nil && err != http.ErrNotMultipart {
+		c.Errors = append(c.Errors, err)
+	}
+	c.formCache = c.Req.PostForm
+	if c.formCache == nil {
+		c.formCache = make(url.Values)
 	}
 }
 
 // PostForm
 // @Description:  获取 POST 请求参数
+// @PS: 与 http.Request.FormValue 一致 优先读取请求体中的表单 不存在时读取 Query String
 // @receiver c
 // @param key
 // @return string
 func (c *Context) PostForm(key string) string {
-	return c.Req.FormValue(key)
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return c.Query(key)
+}
+
+// DefaultPostForm 获取请求体中的 POST 请求参数 不存在时返回 defaultValue 不读取 Query String
+func (c *Context) DefaultPostForm(key string, defaultValue string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetPostForm
+// @Description: 获取请求体中的 POST 请求参数 同名参数有多个时返回第一个
+// @receiver c
+// @param key
+// @return string
+// @return bool	参数是否存在 例如 name= 存在但值为空
+func (c *Context) GetPostForm(key string) (string, bool) {
+	if values, ok := c.GetPostFormArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// PostFormArray 获取同名的全部 POST 请求参数
+func (c *Context) PostFormArray(key string) []string {
+	values, _ := c.GetPostFormArray(key)
+	return values
+}
+
+// GetPostFormArray 获取同名的全部 POST 请求参数 以及参数是否存在
+func (c *Context) GetPostFormArray(key string) ([]string, bool) {
+	c.initFormCache()
+	values, ok := c.formCache[key]
+	return values, ok && len(values) > 0
+}
+
+// PostFormMap 获取 key[k]=v 形式的 POST 请求参数
+func (c *Context) PostFormMap(key string) map[string]string {
+	dict, _ := c.GetPostFormMap(key)
+	return dict
+}
+
+// GetPostFormMap 获取 key[k]=v 形式的 POST 请求参数 以及参数是否存在
+func (c *Context) GetPostFormMap(key string) (map[string]string, bool) {
+	c.initFormCache()
+	return bracketMap(c.formCache, key)
+}
+
+// maxMultipartMemory 解析 multipart 表单时使用的内存上限
+func (c *Context) maxMultipartMemory() int64 {
+	if c.engine != nil {
+		return c.engine.MaxMultipartMemory
+	}
+	return defaultMultipartMemory
+}
+
+// MultipartForm
+// @Description: 解析 multipart 表单 包括上传的文件
+// @PS: 内存中最多保存 Engine.MaxMultipartMemory 字节 超出的部分写入临时文件
+// @receiver c
+// @return *multipart.Form
+// @return error	请求体超出 BodyLimit 时为 ErrBodyTooLarge
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.Req.ParseMultipartForm(c.maxMultipartMemory()); err != nil {
+		if bodyTooLarge(c.Req) {
+			return nil, ErrBodyTooLarge
+		}
+		return nil, err
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// FormFile
+// @Description: 获取上传的文件
+// @receiver c
+// @param name	表单字段名
+// @return *multipart.FileHeader
+// @return error
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if files := form.File[name]; len(files) > 0 {
+		return files[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// SaveUploadedFile
+// @Description: 将上传的文件保存到 dst 目录不存在时自动创建
+// @receiver c
+// @param file
+// @param dst
+// @return error
+func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+// initQueryCache 解析 Query String
+func (c *Context) initQueryCache() {
+	if c.queryCache == nil {
+		c.queryCache = c.Req.URL.Query()
+	}
 }
 
 // Query
-// @Description: 获取 Query String 中的参数
+// @Description: 获取 Query String 中的参数 同名参数有多个时返回第一个
 // @receiver c
 // @param key
 // @return string
 func (c *Context) Query(key string) string {
-	return c.Req.URL.Query().Get(key)
+	value, _ := c.GetQuery(key)
+	return value
+}
+
+// DefaultQuery 获取 Query String 中的参数 不存在时返回 defaultValue
+func (c *Context) DefaultQuery(key string, defaultValue string) string {
+	if value, ok := c.GetQuery(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetQuery
+// @Description: 获取 Query String 中的参数
+// @receiver c
+// @param key
+// @return string
+// @return bool	参数是否存在 例如 /?name= 存在但值为空
+func (c *Context) GetQuery(key string) (string, bool) {
+	if values, ok := c.GetQueryArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// QueryArray 获取同名的全部参数 例如 /?ids=1&ids=2
+func (c *Context) QueryArray(key string) []string {
+	values, _ := c.GetQueryArray(key)
+	return values
+}
+
+// GetQueryArray 获取同名的全部参数 以及参数是否存在
+func (c *Context) GetQueryArray(key string) ([]string, bool) {
+	c.initQueryCache()
+	values, ok := c.queryCache[key]
+	return values, ok && len(values) > 0
+}
+
+// QueryMap 获取 key[k]=v 形式的参数 例如 /?ids[a]=1&ids[b]=2 返回 {"a": "1", "b": "2"}
+func (c *Context) QueryMap(key string) map[string]string {
+	dict, _ := c.GetQueryMap(key)
+	return dict
+}
+
+// GetQueryMap 获取 key[k]=v 形式的参数 以及参数是否存在
+func (c *Context) GetQueryMap(key string) (map[string]string, bool) {
+	c.initQueryCache()
+	return bracketMap(c.queryCache, key)
+}
+
+// bracketMap
+// @Description: 从 values 中提取 key[k]=v 形式的参数
+// @param values
+// @param key
+// @return map[string]string	同一个 k 有多个值时取第一个
+// @return bool	是否存在
+func bracketMap(values url.Values, key string) (map[string]string, bool) {
+	dict := make(map[string]string)
+	exists := false
+	for k, v := range values {
+		if len(v) == 0 || len(k) <= len(key)+2 || k[len(k)-1] != ']' {
+			continue
+		}
+		if k[:len(key)] == key && k[len(key)] == '[' {
+			if i := strings.IndexByte(k[len(key)+1:], ']'); i == len(k)-len(key)-2 {
+				exists = true
+				dict[k[len(key)+1:len(k)-1]] = v[0]
+			}
+		}
+	}
+	return dict, exists
+}
+
+// ContentType
+// @Description: 请求的 Content-Type 去掉 charset 等参数
+// @receiver c
+// @return string
+func (c *Context) ContentType() string {
+	contentType := c.Req.Header.Get("Content-Type")
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.TrimSpace(contentType)
+}
+
+// Bind
+// @Description: 根据请求方法和 Content-Type 选择 Binding 将请求数据绑定到 obj
+// @PS: GET 请求绑定 Query String JSON/XML 请求绑定请求体 其余按表单绑定
+// @PS: 绑定成功后会按 binding 标签校验 校验失败时返回 ValidationErrors
+// @PS: 绑定失败时只返回错误 不会写入响应
+// @receiver c
+// @param obj	结构体指针
+// @return error
+func (c *Context) Bind(obj interface{}) error {
+	return c.BindWith(obj, bindingFor(c.Method, c.ContentType()))
+}
+
+// BindWith
+// @Description: 使用指定的 Binding 绑定请求数据
+// @receiver c
+// @param obj
+// @param b
+// @return error
+func (c *Context) BindWith(obj interface{}, b Binding) error {
+	// 提前按 Engine 的 MaxMultipartMemory 解析 multipart 表单 Binding 不会再重复解析
+	if b == BindingForm && c.ContentType() == MIMEMultipartPOSTForm {
+		if _, err := c.MultipartForm(); err != nil {
+			return err
+		}
+	}
+	if err := b.Bind(c.Req, obj); err != nil {
+		return err
+	}
+	return validate(obj)
+}
+
+// BindJSON 将 JSON 请求体绑定到 obj
+func (c *Context) BindJSON(obj interface{}) error {
+	return c.BindWith(obj, BindingJSON)
+}
+
+// BindXML 将 XML 请求体绑定到 obj
+func (c *Context) BindXML(obj interface{}) error {
+	return c.BindWith(obj, BindingXML)
+}
+
+// BindQuery 将 Query String 绑定到 obj 使用 form 标签
+func (c *Context) BindQuery(obj interface{}) error {
+	return c.BindWith(obj, BindingQuery)
+}
+
+// BindForm 将表单和 Query String 绑定到 obj 使用 form 标签
+func (c *Context) BindForm(obj interface{}) error {
+	return c.BindWith(obj, BindingForm)
+}
+
+// BindHeader 将请求头绑定到 obj 使用 header 标签
+func (c *Context) BindHeader(obj interface{}) error {
+	return c.BindWith(obj, BindingHeader)
+}
+
+// BindURI
+// @Description: 将路由参数绑定到 obj 使用 uri 标签 例如 /users/:id 对应 `uri:"id"`
+// @receiver c
+// @param obj
+// @return error
+func (c *Context) BindURI(obj interface{}) error {
+	if err := mapForm(obj, paramsSource(c.Params), "uri"); err != nil {
+		return err
+	}
+	return validate(obj)
 }
 
 // Status
-// @Description: 设置响应状态码 code
+// @Description: 设置响应状态码 code 响应头在第一次写入响应体时才发送
+// @PS: 通过 c.Writer.Status() 获取状态码 直接写入 c.Writer 时默认为 200
 // @receiver c
 // @param code
 func (c *Context) Status(code int) {
-	c.StatusCode = code
 	c.Writer.WriteHeader(code)
+	c.StatusCode = c.Writer.Status()
 }
 
 // SetHeader
@@ -89,6 +702,28 @@ func (c *Context) SetHeader(key string, value string) {
 	c.Writer.Header().Set(key, value)
 }
 
+// Render
+// @Description: 使用 Render 写入响应
+// @PS: 渲染失败且响应尚未发送时返回 500 已经发送时错误记录在 c.Errors 中
+// @receiver c
+// @param code
+// @param r
+func (c *Context) Render(code int, r Render) {
+	c.Status(code)
+	r.WriteContentType(c.Writer)
+	if !bodyAllowedForStatus(code) {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	if err := r.Render(c.Writer); err != nil {
+		c.Errors = append(c.Errors, err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Fail(http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
 // String
 // @Description: 向HTTP链接中写入回复数据
 // @receiver c
@@ -96,15 +731,7 @@ func (c *Context) SetHeader(key string, value string) {
 // @param format
 // @param values...interface{}
 func (c *Context) String(code int, format string, values ...interface{}) {
-	c.SetHeader("Content-Type", "text/plain")
-	c.Status(code)
-	// Write 向连接中写入作为 HTTP 的一部分回复的数据。
-	// 如果被调用时还未调用 WriteHeader，本方法会先调用 WriteHeader(http.StatusOK)
-	// 如果 Header 中没有 "Content-Type" 键，
-	// 本方法会使用包函数 DetectContentType 检查数据的前 512 字节，将返回值作为该键的值。
-
-	// Sprintf 根据 format 参数生成格式化的字符串并返回该字符串。
-	c.Writer.Write([]byte(fmt.Sprintf(format, values...)))
+	c.Render(code, StringRender{Format: format, Data: values})
 }
 
 // JSON
@@ -113,30 +740,297 @@ func (c *Context) String(code int, format string, values ...interface{}) {
 // @param code
 // @param obj
 func (c *Context) JSON(code int, obj interface{}) {
-	c.SetHeader("Content-Type", "text/json")
-	c.Status(code)
-	// NewDecoder 创建一个从 c.Writer 读取并解码 json 对象的 *Decoder，解码器有自己的缓冲，并可能超前读取部分 json 数据。
-	encoder := json.NewEncoder(c.Writer)
-	// Encode将 obj 的 json 编码写入输出流，并会写入一个换行符
-	if err := encoder.Encode(obj); err != nil {
-		http.Error(c.Writer, err.Error(), 500)
+	c.Render(code, JSONRender{Data: obj})
+}
+
+// IndentedJSON 返回带缩进的 JSON 便于阅读 会消耗更多的 CPU 和带宽
+func (c *Context) IndentedJSON(code int, obj interface{}) {
+	c.Render(code, IndentedJSONRender{Data: obj})
+}
+
+// PureJSON 返回 JSON 不转义 <、>、& 等 HTML 字符
+func (c *Context) PureJSON(code int, obj interface{}) {
+	c.Render(code, PureJSONRender{Data: obj})
+}
+
+// SecureJSON
+// @Description: 返回 JSON 数据为数组时加上前缀(默认 while(1);) 防止 JSON 劫持
+// @receiver c
+// @param code
+// @param obj
+func (c *Context) SecureJSON(code int, obj interface{}) {
+	prefix := defaultSecureJSONPrefix
+	if c.engine != nil {
+		prefix = c.engine.secureJSONPrefix
+	}
+	c.Render(code, SecureJSONRender{Prefix: prefix, Data: obj})
+}
+
+// JSONP
+// @Description: 使用 Query String 中的 callback 包裹 JSON 没有 callback 时返回普通 JSON
+// @PS: callback 不是合法的标识符时返回 400 防止在响应中注入脚本
+// @receiver c
+// @param code
+// @param obj
+func (c *Context) JSONP(code int, obj interface{}) {
+	callback := c.DefaultQuery("callback", "")
+	if callback == "" {
+		c.JSON(code, obj)
+		return
 	}
+	if !jsonpCallbackPattern.MatchString(callback) {
+		c.Fail(http.StatusBadRequest, ErrInvalidJSONPCallback.Error())
+		return
+	}
+	c.Render(code, JSONPRender{Callback: callback, Data: obj})
+}
+
+// XML 返回 XML 类型数据
+func (c *Context) XML(code int, obj interface{}) {
+	c.Render(code, XMLRender{Data: obj})
+}
+
+// YAML 返回 YAML 类型数据
+func (c *Context) YAML(code int, obj interface{}) {
+	c.Render(code, YAMLRender{Data: obj})
 }
 
 func (c *Context) Data(code int, data []byte) {
-	c.Status(code)
-	c.Writer.Write(data)
+	c.Render(code, DataRender{Data: data})
 }
 
+// DataFromReader
+// @Description: 将 reader 中的数据写入响应
+// @PS: code 为 200 且 reader 实现了 io.ReadSeeker 时支持 Range 和条件请求 此时 contentLength 由 Seek 得到 extraHeaders 中的 Last-Modified、ETag 会参与条件请求的判断
+// @receiver c
+// @param code
+// @param contentLength	小于 0 时不设置 Content-Length
+// @param contentType
+// @param reader
+// @param extraHeaders
+func (c *Context) DataFromReader(code int, contentLength int64, contentType string, reader io.Reader, extraHeaders map[string]string) {
+	seeker, ok := reader.(io.ReadSeeker)
+	if !ok || code != http.StatusOK {
+		c.Render(code, ReaderRender{
+			ContentType:   contentType,
+			ContentLength: contentLength,
+			Headers:       extraHeaders,
+			Reader:        reader,
+		})
+		return
+	}
+
+	header := c.Writer.Header()
+	for key, value := range extraHeaders {
+		header.Set(key, value)
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	modtime, _ := http.ParseTime(header.Get("Last-Modified"))
+	http.ServeContent(c.Writer, c.Req, "", modtime, seeker)
+}
+
+// File
+// @Description: 将本地文件写入响应 支持 Range、If-Modified-Since、If-None-Match 等条件请求
+// @receiver c
+// @param filepath
+func (c *Context) File(filepath string) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	c.serveFile(f, filepath)
+}
+
+// FileFromFS 与 File 相同 但是从 fs 中读取文件
+func (c *Context) FileFromFS(filepath string, fs http.FileSystem) {
+	f, err := fs.Open(filepath)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	c.serveFile(f, filepath)
+}
+
+// FileAttachment
+// @Description: 以附件的形式返回文件 浏览器会下载而不是打开
+// @PS: 文件不存在等错误响应中不会带有 Content-Disposition 避免浏览器把错误信息当作文件下载
+// @receiver c
+// @param filepath
+// @param filename	下载时的文件名 可以包含非 ASCII 字符
+func (c *Context) FileAttachment(filepath string, filename string) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && !info.IsDir() {
+		c.SetHeader("Content-Disposition", contentDisposition("attachment", filename))
+	}
+	c.serveFile(f, filepath)
+}
+
+// serveFile
+// @Description: 使用 http.ServeContent 写入文件 没有设置 ETag 时根据修改时间和大小生成
+// @receiver c
+// @param f
+// @param name	用于根据扩展名推断 Content-Type
+func (c *Context) serveFile(f http.File, name string) {
+	info, err := f.Stat()
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	if info.IsDir() {
+		c.fileError(os.ErrNotExist)
+		return
+	}
+	header := c.Writer.Header()
+	if header.Get("ETag") == "" {
+		header.Set("ETag", fileETag(info))
+	}
+	http.ServeContent(c.Writer, c.Req, name, info.ModTime(), f)
+}
+
+// fileError 文件不存在时返回 404 没有权限时返回 403
+func (c *Context) fileError(err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, os.ErrPermission):
+		code = http.StatusForbidden
+	}
+	c.Fail(code, http.StatusText(code))
+}
+
+// fileETag 根据修改时间和文件大小生成 ETag
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// contentDisposition
+// @Description: 生成 Content-Disposition 文件名包含非 ASCII 字符时使用 RFC 5987 的 filename* 形式
+// @param disposition	attachment 或 inline
+// @param filename
+// @return string
+func contentDisposition(disposition string, filename string) string {
+	for _, r := range filename {
+		if r >= utf8.RuneSelf || r < 0x20 {
+			return disposition + "; filename*=UTF-8''" + url.PathEscape(filename)
+		}
+	}
+	return disposition + "; filename=" + strconv.Quote(filename)
+}
+
+// Negotiate
+// @Description: 根据请求的 Accept 头选择响应格式 例如同一个处理器同时提供 JSON 和 XML
+// @PS: 没有可以提供的格式时返回 406
+// @receiver c
+// @param code
+// @param config
+func (c *Context) Negotiate(code int, config Negotiate) {
+	switch c.NegotiateFormat(config.Offered...) {
+	case MIMEJSON:
+		c.JSON(code, chooseData(config.JSONData, config.Data))
+	case MIMEXML, MIMEXML2:
+		c.XML(code, chooseData(config.XMLData, config.Data))
+	case MIMEYAML:
+		c.YAML(code, chooseData(config.YAMLData, config.Data))
+	case MIMEHTML:
+		c.HTML(code, config.HTMLName, chooseData(config.HTMLData, config.Data))
+	case MIMEPlain:
+		c.String(code, "%v", config.Data)
+	default:
+		_ = c.AbortWithError(http.StatusNotAcceptable, errors.New("gee: the accepted formats are not offered by the server"))
+	}
+}
+
+// NegotiateFormat
+// @Description: 从 offered 中选出 Accept 最偏好的格式
+// @PS: 使用 q=0 明确拒绝的格式不会被 */* 等通配符匹配
+// @receiver c
+// @param offered
+// @return string	没有 Accept 头时返回第一个 没有匹配时返回空字符串
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	accept := c.Req.Header.Get("Accept")
+	if accept == "" {
+		return offered[0]
+	}
+	accepts, refused := parseAccept(accept)
+	for _, accepted := range accepts {
+		for _, offer := range offered {
+			if matchMIME(accepted, offer) && !refused[offer] {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+// chooseData 优先使用单独设置的数据
+func chooseData(custom interface{}, common interface{}) interface{} {
+	if custom != nil {
+		return custom
+	}
+	return common
+}
+
+// HTML
+// @Description: 使用 Engine 的 HTML 渲染器渲染模板
+// @receiver c
+// @param code
+// @param name	模板名或 AddHTMLSet 添加的页面名称
+// @param data
 func (c *Context) HTML(code int, name string, data interface{}) {
-	c.SetHeader("Content-Type", "text/html")
-	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(http.StatusInternalServerError, err.Error())
+	var r Render = HTMLRender{}
+	if c.engine != nil && c.engine.htmlRender != nil {
+		r = c.engine.htmlRender.Instance(name, data)
 	}
+	c.Render(code, r)
 }
 
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
-	c.JSON(code, H{"message": err})
+	c.AbortWithStatusJSON(code, H{"message": err})
+}
+
+// SSEvent
+// @Description: 发送一条 Server-Sent Events 消息并立即刷新到客户端
+// @receiver c
+// @param name	事件名 为空时浏览器触发 message 事件
+// @param message
+func (c *Context) SSEvent(name string, message interface{}) {
+	c.Render(-1, SSEventRender{Event: name, Data: message})
+	c.Writer.Flush()
+}
+
+// Stream
+// @Description: 分块写入响应 每次 step 返回后刷新到客户端 step 返回 false 时结束
+// @PS: 客户端断开连接(请求的 context 被取消)后不再调用 step
+// @receiver c
+// @param step
+// @return bool	是否因客户端断开而结束
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	w := c.Writer
+	clientGone := c.Req.Context().Done()
+	for {
+		select {
+		case <-clientGone:
+			return true
+		default:
+			keepOpen := step(w)
+			w.Flush()
+			if !keepOpen {
+				return false
+			}
+		}
+	}
 }
@@ -0,0 +1,497 @@
+package gee
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+Context 对象池带来的内存分配变化
+
+$ go test -run none -bench ServeHTTP -benchmem
+BenchmarkServeHTTP/alloc         	 1506333	       700.2 ns/op	     352 B/op	       4 allocs/op
+BenchmarkServeHTTP/pool          	 7443266	       192.0 ns/op	       0 B/op	       0 allocs/op
+*/
+
+// benchWriter 不产生内存分配的 ResponseWriter 仅用于基准测试
+type benchWriter struct {
+	header http.Header
+}
+
+func (w *benchWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *benchWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *benchWriter) WriteHeader(int) {}
+
+func TestContextCopy(t *testing.T) {
+	r := New()
+	copied := make(chan *Context, 1)
+	r.GET("/users/:id", func(c *Context) {
+		copied <- c.Copy()
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	cp := <-copied
+	// 原 Context 已放回对象池 再次处理请求不应影响副本
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+	<-copied
+	if cp.Param("id") != "1" || cp.Path != "/users/1" {
+		t.Fatalf("copied context changed: id=%s path=%s", cp.Param("id"), cp.Path)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	r := New()
+	r.GET("/repos/:owner/:repo/issues/:number", func(c *Context) {
+		c.Status(http.StatusOK)
+	})
+	w := &benchWriter{header: make(http.Header)}
+	req := httptest.NewRequest(http.MethodGet, "/repos/geektutu/gee/issues/7", nil)
+
+	// 每个请求新建 Context 对象池引入之前的做法
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c := &Context{engine: r}
+			c.reset(w, req)
+			r.router.handle(c)
+		}
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r.ServeHTTP(w, req)
+		}
+	})
+}
+
+func TestAbort(t *testing.T) {
+	r := New()
+	var order []string
+	r.Use(func(c *Context) {
+		c.Next()
+		order = append(order, "logger")
+		if !c.IsAborted() {
+			t.Error("chain should be reported as aborted")
+		}
+	})
+	r.Use(func(c *Context) {
+		// 嵌套的 Next 不应让中止的处理链继续执行
+		c.Next()
+		c.Next()
+	})
+	auth := func(c *Context) {
+		if c.Query("token") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+		order = append(order, "auth")
+	}
+	r.GET("/admin", auth, func(c *Context) {
+		order = append(order, "handler")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if w.Code != http.StatusUnauthorized || w.Body.Len() != 0 {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if len(order) != 2 || order[0] != "auth" || order[1] != "logger" {
+		t.Fatalf("handlers run in %v", order)
+	}
+}
+
+func TestAbortWithError(t *testing.T) {
+	r := New()
+	var errs []error
+	r.Use(func(c *Context) {
+		c.Next()
+		errs = append([]error(nil), c.Errors...)
+	})
+	r.GET("/fail", func(c *Context) {
+		_ = c.AbortWithError(http.StatusBadRequest, http.ErrNoCookie)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if w.Code != http.StatusBadRequest || len(errs) != 1 || errs[0] != http.ErrNoCookie {
+		t.Fatalf("unexpected response %d, errors %v", w.Code, errs)
+	}
+}
+
+func TestContextKeys(t *testing.T) {
+	r := New()
+	now := time.Now()
+	r.Use(func(c *Context) {
+		c.Set("user", "geektutu")
+		c.Set("uid", 7)
+		c.Set("login", now)
+		c.Next()
+	})
+	r.GET("/me", func(c *Context) {
+		if c.GetString("user") != "geektutu" || c.GetInt("uid") != 7 || !c.GetTime("login").Equal(now) {
+			t.Errorf("unexpected values %v", c.Keys)
+		}
+		// 类型不匹配时返回零值
+		if c.GetInt("user") != 0 || c.GetString("none") != "" {
+			t.Error("mismatched types should return zero values")
+		}
+		if c.MustGet("user") != "geektutu" {
+			t.Error("MustGet should return the stored value")
+		}
+		// 作为 context.Context 使用
+		var ctx context.Context = c
+		if ctx.Value("user") != "geektutu" || ctx.Value(ctxKey{}) != "from request" {
+			t.Error("Value should read Keys first and then the request context")
+		}
+		if ctx.Err() != nil {
+			t.Errorf("unexpected error %v", ctx.Err())
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "from request"))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+type ctxKey struct{}
+
+func TestContextCancel(t *testing.T) {
+	r := New()
+	r.GET("/slow", func(c *Context) {
+		select {
+		case <-c.Done():
+			c.Status(http.StatusServiceUnavailable)
+		case <-time.After(time.Second):
+			c.Status(http.StatusOK)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("handler should observe the canceled request, got %d", w.Code)
+	}
+}
+
+// newUploadRequest 构造上传文件的 multipart 请求
+func newUploadRequest(t *testing.T, field, filename, content string) *http.Request {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte(content))
+	_ = mw.WriteField("title", "avatar")
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	r := New()
+	r.MaxMultipartMemory = 1 << 10
+	r.POST("/upload", BodyLimit(1<<20), func(c *Context) {
+		file, err := c.FormFile("file")
+		if errors.Is(err, ErrBodyTooLarge) {
+			c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := c.SaveUploadedFile(file, filepath.Join(dir, "images", file.Filename)); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%s %d %s", file.Filename, file.Size, c.PostForm("title"))
+	})
+
+	content := strings.Repeat("x", 4<<10) // 大于 MaxMultipartMemory 会写入临时文件
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "file", "gee.png", content))
+	if w.Code != http.StatusOK || w.Body.String() != "gee.png 4096 avatar" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if saved, err := os.ReadFile(filepath.Join(dir, "images", "gee.png")); err != nil || string(saved) != content {
+		t.Fatalf("file not saved: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "other", "gee.png", content))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("missing file should fail, got %d", w.Code)
+	}
+
+	// 声明了 Content-Length 时直接返回 413
+	big := strings.Repeat("x", 2<<20)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "file", "big.png", big))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413, got %d", w.Code)
+	}
+
+	// 未声明长度时 读取超出限制返回 ErrBodyTooLarge
+	req := newUploadRequest(t, "file", "big.png", big)
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 for chunked body, got %d", w.Code)
+	}
+
+	// 处理函数忽略了读取错误 也要返回 413
+	var errs []error
+	r.POST("/form", BodyLimit(1<<10), func(c *Context) {
+		c.PostForm("title")
+		errs = c.Errors
+	})
+	req = httptest.NewRequest(http.MethodPost, "/form", strings.NewReader("title="+strings.Repeat("x", 2<<10)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 for ignored chunked body, got %d", w.Code)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrBodyTooLarge) {
+		t.Fatalf("form parse error not recorded: %v", errs)
+	}
+}
+
+func TestQueryAndPostForm(t *testing.T) {
+	form := url.Values{
+		"name":      {"geektutu"},
+		"tags":      {"go", "web"},
+		"empty":     {""},
+		"user[id]":  {"7"},
+		"user[age]": {"20"},
+	}
+	req := httptest.NewRequest(http.MethodPost,
+		"/filter?ids=1&ids=2&ids[a]=3&ids[b]=4&page=&name=query", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", MIMEPOSTForm)
+	c := &Context{Req: req}
+
+	if c.Query("name") != "query" || c.DefaultQuery("size", "20") != "20" || c.DefaultQuery("page", "1") != "" {
+		t.Fatal("unexpected query values")
+	}
+	if _, ok := c.GetQuery("page"); !ok {
+		t.Fatal("empty query value should exist")
+	}
+	if ids := c.QueryArray("ids"); !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Fatalf("unexpected query array %v", ids)
+	}
+	if ids := c.QueryMap("ids"); !reflect.DeepEqual(ids, map[string]string{"a": "3", "b": "4"}) {
+		t.Fatalf("unexpected query map %v", ids)
+	}
+	if _, ok := c.GetQueryMap("none"); ok {
+		t.Fatal("missing query map should not exist")
+	}
+
+	// PostForm 优先读取请求体 其余 PostForm 系列方法不包括 Query String
+	if c.PostForm("name") != "geektutu" || c.PostForm("ids") != "1" || c.PostForm("lang") != "" {
+		t.Fatal("unexpected post form values")
+	}
+	if c.DefaultPostForm("ids", "0") != "0" || c.DefaultPostForm("lang", "go") != "go" {
+		t.Fatal("unexpected default post form values")
+	}
+	if value, ok := c.GetPostForm("empty"); !ok || value != "" {
+		t.Fatal("empty post form value should exist")
+	}
+	if tags := c.PostFormArray("tags"); !reflect.DeepEqual(tags, []string{"go", "web"}) {
+		t.Fatalf("unexpected post form array %v", tags)
+	}
+	if user := c.PostFormMap("user"); !reflect.DeepEqual(user, map[string]string{"id": "7", "age": "20"}) {
+		t.Fatalf("unexpected post form map %v", user)
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	r := New()
+	var status, size, statusCode int
+	r.Use(func(c *Context) {
+		c.Next()
+		status, size, statusCode = c.Writer.Status(), c.Writer.Size(), c.StatusCode
+	})
+	r.GET("/raw", func(c *Context) {
+		_, _ = c.Writer.Write([]byte("hello"))
+	})
+	r.GET("/partial", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		// 响应头已经发送 之后的状态码会被忽略
+		c.Fail(http.StatusInternalServerError, "failed")
+	})
+	r.GET("/status", func(c *Context) {
+		c.Status(http.StatusCreated)
+		c.Status(http.StatusAccepted)
+	})
+	r.GET("/direct", func(c *Context) {
+		// 绕过 Status 直接写入 StatusCode 依然会同步
+		c.Writer.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		path         string
+		status, size int
+	}{
+		{"/raw", http.StatusOK, 5},
+		{"/partial", http.StatusOK, len("partial") + len(`{"message":"failed"}`) + 1},
+		{"/status", http.StatusAccepted, noWritten}, // 响应头在处理链结束后才发送
+		{"/direct", http.StatusNoContent, noWritten},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if status != tt.status || size != tt.size || w.Code != tt.status || statusCode != tt.status {
+			t.Fatalf("%s: status %d size %d code %d StatusCode %d, want %d %d", tt.path, status, size, w.Code, statusCode, tt.status, tt.size)
+		}
+	}
+
+	// 包装后依然支持 Flusher 与 Pusher
+	w := httptest.NewRecorder()
+	rw := &responseWriter{}
+	rw.reset(w)
+	rw.Flush()
+	if !w.Flushed || !rw.Written() {
+		t.Fatal("Flush should send headers and flush the underlying writer")
+	}
+	if err := rw.Push("/style.css", nil); err != http.ErrNotSupported {
+		t.Fatalf("expect ErrNotSupported, got %v", err)
+	}
+	if _, _, err := rw.Hijack(); err == nil {
+		t.Fatal("httptest.ResponseRecorder does not support hijacking")
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "video.txt")
+	if err := os.WriteFile(name, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modtime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(name, modtime, modtime)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+
+	r := New()
+	r.GET("/file", func(c *Context) { c.File(name) })
+	r.GET("/fs/*name", func(c *Context) { c.FileFromFS(c.Param("name"), http.Dir(dir)) })
+	r.GET("/download", func(c *Context) { c.FileAttachment(name, "报告 2021.txt") })
+	r.GET("/download/*name", func(c *Context) { c.FileAttachment(filepath.Join(dir, c.Param("name")), "a.txt") })
+	r.GET("/missing", func(c *Context) { c.File(filepath.Join(dir, "missing")) })
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/file", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" || etag == "" ||
+		w.Header().Get("Accept-Ranges") != "bytes" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("GET /file = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		code   int
+		body   string
+	}{
+		{"range", "/file", map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "2345"},
+		{"suffix range", "/fs/video.txt", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "789"},
+		{"invalid range", "/file", map[string]string{"Range": "bytes=20-"}, http.StatusRequestedRangeNotSatisfiable, ""},
+		{"if-none-match", "/file", map[string]string{"If-None-Match": etag}, http.StatusNotModified, ""},
+		{"if-modified-since", "/file", map[string]string{"If-Modified-Since": modtime.Format(http.TimeFormat)}, http.StatusNotModified, ""},
+		{"modified", "/file", map[string]string{"If-Modified-Since": modtime.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK, "0123456789"},
+		{"if-range stale", "/file", map[string]string{"Range": "bytes=0-1", "If-Range": `"stale"`}, http.StatusOK, "0123456789"},
+		{"missing", "/missing", nil, http.StatusNotFound, `{"message":"Not Found"}` + "\n"},
+		{"directory", "/fs/sub", nil, http.StatusNotFound, `{"message":"Not Found"}` + "\n"},
+	}
+	for _, tt := range tests {
+		w := get(tt.path, tt.header)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+
+	w = get("/download", nil)
+	if cd := w.Header().Get("Content-Disposition"); cd != "attachment; filename*=UTF-8''%E6%8A%A5%E5%91%8A%202021.txt" {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+	for _, path := range []string{"/download/missing", "/download/sub"} {
+		w = get(path, nil)
+		if w.Code != http.StatusNotFound || w.Header().Get("Content-Disposition") != "" {
+			t.Fatalf("GET %s = %d %v", path, w.Code, w.Header())
+		}
+	}
+	if cd := contentDisposition("attachment", `a"b.txt`); cd != `attachment; filename="a\"b.txt"` {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+}
+
+func TestDataFromReader(t *testing.T) {
+	r := New()
+	r.GET("/seek", func(c *Context) {
+		c.DataFromReader(http.StatusOK, 10, "video/mp4", strings.NewReader("0123456789"), map[string]string{
+			"ETag":          `"v1"`,
+			"Last-Modified": "Fri, 01 Jan 2021 00:00:00 GMT",
+		})
+	})
+	r.GET("/stream", func(c *Context) {
+		c.DataFromReader(http.StatusAccepted, 5, "text/plain", io.LimitReader(strings.NewReader("hello world"), 5),
+			map[string]string{"Content-Disposition": `attachment; filename="a.txt"`})
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/seek", nil)
+	req.Header.Set("Range", "bytes=4-")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "456789" || w.Header().Get("Content-Range") != "bytes 4-9/10" {
+		t.Fatalf("range = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/seek", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "hello" || w.Header().Get("Content-Length") != "5" ||
+		w.Header().Get("Content-Type") != "text/plain" || w.Header().Get("Content-Disposition") == "" {
+		t.Fatalf("stream = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+}
@@ -0,0 +1,89 @@
+package gee
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo
+// @Description: 一条已注册的路由
+type RouteInfo struct {
+	Method      string
+	Path        string
+	Handler     string // 处理器的函数名
+	Middlewares int    // 处理器之前的中间件数量
+	HandlerFunc HandlerFunc
+}
+
+// Routes
+// @Description: 全部已注册的路由 按路径和请求方法排序
+// @receiver engine
+// @return []RouteInfo
+func (engine *Engine) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(engine.router.handlers))
+	for key, handlers := range engine.router.handlers {
+		method, pattern := splitRouteKey(key)
+		last := handlers[len(handlers)-1]
+		routes = append(routes, RouteInfo{
+			Method:      method,
+			Path:        pattern,
+			Handler:     nameOfFunction(last),
+			Middlewares: len(handlers) - 1,
+			HandlerFunc: last,
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// splitRouteKey 将 router.handlers 的 key 拆分为请求方法和路由
+// 请求方法中可能包含 - 例如 M-SEARCH 而路由总是以 / 开头 所以在第一个 -/ 处拆分
+func splitRouteKey(key string) (string, string) {
+	i := strings.Index(key, "-/")
+	return key[:i], key[i+1:]
+}
+
+// nameOfFunction 函数名 例如 main.main.func1
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+// debugPrint 只在调试模式下输出
+func debugPrint(format string, values ...interface{}) {
+	if IsDebugging() {
+		log.Printf("[GEE-debug] "+format, values...)
+	}
+}
+
+// debugPrintWarningDefault 创建 Engine 时提示当前为调试模式
+func debugPrintWarningDefault() {
+	debugPrint(`[WARNING] Running in "debug" mode. Switch to "release" mode in production.
+ - using env:	export GEE_MODE=release
+ - using code:	gee.SetMode(gee.ReleaseMode)`)
+}
+
+// debugPrintRoutes 以表格的形式输出路由
+func debugPrintRoutes(routes []RouteInfo) {
+	if !IsDebugging() {
+		return
+	}
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tHANDLER\tMIDDLEWARES")
+	for _, route := range routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", route.Method, route.Path, route.Handler, route.Middlewares)
+	}
+	w.Flush()
+	debugPrint("%d routes registered:\n%s", len(routes), buf.String())
+}
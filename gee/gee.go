@@ -1,11 +1,15 @@
 package gee
 
 import (
+	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
 	"net/http"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // HandlerFunc 定义一个 request Handler 的类型
@@ -18,25 +22,51 @@ type RouterGroup struct {
 	middlewares []HandlerFunc // 中间件
 	parent      *RouterGroup  // 支持嵌套
 	engine      *Engine       // 所有的分组共享一个 Engine 示例
+	noRoute     []HandlerFunc // 分组前缀下路由不存在时的处理器
 }
 
 // Engine
 // @Description: 实现了 ServeHTTP 的 Engine
 type Engine struct {
 	*RouterGroup
-	router        *router
-	groups        []*RouterGroup     // 存储所有的分组
-	htmlTemplates *template.Template // HTML render
-	funcMap       template.FuncMap   // HTML render
+	router      *router
+	groups      []*RouterGroup   // 存储所有的分组
+	htmlRender  HTMLRenderer     // HTML render
+	htmlSources []htmlSource     // 已加载的模板 用于重新解析
+	funcMap     template.FuncMap // HTML render
+	noMethod    []HandlerFunc    // 请求方法不匹配时的处理器
+	pool        sync.Pool        // Context 对象池
+
+	secureJSONPrefix string // SecureJSON 使用的前缀
+
+	// HandleMethodNotAllowed 路径存在但请求方法不匹配时 返回 405 并设置 Allow 头 关闭后返回 404
+	HandleMethodNotAllowed bool
+	// HandleOPTIONS 未注册 OPTIONS 路由时 自动响应 OPTIONS 请求
+	HandleOPTIONS bool
+	// MaxMultipartMemory 解析 multipart 表单时 内存中最多保存的字节数 超出的部分写入临时文件
+	MaxMultipartMemory int64
+	// CheckWSOrigin 校验 WebSocket 握手请求的 Origin 为 nil 时只允许同源请求
+	CheckWSOrigin func(req *http.Request) bool
 }
 
 // New
 // @Description: Engine 构造器
 // @return *Engine
 func New() *Engine {
-	engine := &Engine{router: newRouter()}             // 构造一个 Engine
+	// 构造一个 Engine
+	engine := &Engine{
+		router:                 newRouter(),
+		HandleMethodNotAllowed: true,
+		HandleOPTIONS:          true,
+		MaxMultipartMemory:     defaultMultipartMemory,
+		secureJSONPrefix:       defaultSecureJSONPrefix,
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}  // 构造一个路由分组 并且注入 当前 Engine
 	engine.groups = []*RouterGroup{engine.RouterGroup} // 将当前 Engine 的路由分组 放入 Engine 的分组管理中
+	engine.pool.New = func() interface{} {
+		return engine.allocateContext()
+	}
+	debugPrintWarningDefault()
 	return engine
 }
 
@@ -44,6 +74,7 @@ func New() *Engine {
 // @Description: 默认使用 Logger 和 Recovery 中间件
 // @return *Engine
 func Default() *Engine {
+	debugPrint("[WARNING] Creating an Engine instance with the Logger and Recovery middleware already attached.")
 	engine := New()
 	engine.Use(Logger(), Recovery())
 	return engine
@@ -66,35 +97,12 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 	return newGroup
 }
 
-// createStaticHandler
-// @Description: 静态资源处理器
-// @receiver group
-// @param relativePath
-// @param fs
-// @return HandlerFunc
-func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileSystem) HandlerFunc {
-	absolutePath := path.Join(group.prefix, relativePath)
-	fileServer := http.StripPrefix(absolutePath, http.FileServer(fs))
-	return func(c *Context) {
-		file := c.Param("filepath")
-		// 检查文件是否存在 以及 权限是否通过
-		if _, err := fs.Open(file); err != nil {
-			c.Status(http.StatusNotFound)
-			return
-		}
-		fileServer.ServeHTTP(c.Writer, c.Req)
-	}
-}
-
-// Static
-// @Description: 静态文件路由
-// @receiver group
-// @param relativePath
-// @param root
-func (group *RouterGroup) Static(relativePath string, root string) {
-	handler := group.createStaticHandler(relativePath, http.Dir(root))
-	urlPattern := path.Join(relativePath, "/*filepath")
-	group.GET(urlPattern, handler)
+// SecureJSONPrefix
+// @Description: 设置 SecureJSON 使用的前缀
+// @receiver engine
+// @param prefix
+func (engine *Engine) SecureJSONPrefix(prefix string) {
+	engine.secureJSONPrefix = prefix
 }
 
 // SetFuncMap
@@ -105,83 +113,442 @@ func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
 }
 
+// SetHTMLRenderer
+// @Description: 使用自定义的 HTML 渲染器 替换 LoadHTML* 加载的模板
+// @receiver engine
+// @param r
+func (engine *Engine) SetHTMLRenderer(r HTMLRenderer) {
+	engine.htmlRender = r
+	engine.htmlSources = nil
+}
+
 // LoadHTMLGlob
-// @Description:
+// @Description: 加载匹配 pattern 的模板 按模板名(文件名或 define 的名称)渲染
+// @PS: 再次调用 LoadHTMLGlob、LoadHTMLFiles、LoadHTMLFS 会替换之前加载的模板 SetFuncMap 需要在加载之前调用
 // @receiver engine
 // @param pattern
-func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+// @return error	解析失败时保留原来的模板
+func (engine *Engine) LoadHTMLGlob(pattern string) error {
+	return engine.loadHTML(htmlSource{glob: true, patterns: []string{pattern}})
 }
 
-// addRoute
-// @Description: 新增一个路由
+// LoadHTMLFiles 与 LoadHTMLGlob 相同 但是指定文件列表
+func (engine *Engine) LoadHTMLFiles(files ...string) error {
+	return engine.loadHTML(htmlSource{patterns: files})
+}
+
+// LoadHTMLFS 与 LoadHTMLGlob 相同 但是从 fs.FS 中读取 可以直接使用 embed.FS
+func (engine *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) error {
+	return engine.loadHTML(htmlSource{fsys: fsys, patterns: patterns})
+}
+
+// AddHTMLSet
+// @Description: 添加一个页面 页面由布局以及内容、局部模板组成 c.HTML 使用页面名称渲染时从布局开始执行
+// @PS: 布局中使用 {{block "content" .}}{{end}} 预留位置 页面中使用 {{define "content"}}...{{end}} 填充
+// @PS: 每个页面单独解析 不同页面可以定义同名的 block 名称相同时替换之前的页面
 // @receiver engine
-// @param method	请求方法
-// @param pattern	路由 pattern
-// @param handler	路由处理器
-func (engine *Engine) addRoute(method string, pattern string, handler HandlerFunc) {
-	engine.router.addRoute(method, pattern, handler)
+// @param name	页面名称
+// @param layout	布局文件
+// @param patterns	内容与局部模板 支持 glob
+// @return error
+func (engine *Engine) AddHTMLSet(name string, layout string, patterns ...string) error {
+	return engine.loadHTML(htmlSource{set: name, layout: layout, glob: true, patterns: patterns})
+}
+
+// AddHTMLSetFS 与 AddHTMLSet 相同 但是从 fs.FS 中读取
+func (engine *Engine) AddHTMLSetFS(name string, fsys fs.FS, layout string, patterns ...string) error {
+	return engine.loadHTML(htmlSource{set: name, fsys: fsys, layout: layout, patterns: patterns})
+}
+
+// loadHTML 加入一组模板 并重新解析全部模板 全局模板或同名页面会被替换
+func (engine *Engine) loadHTML(src htmlSource) error {
+	sources := make([]htmlSource, 0, len(engine.htmlSources)+1)
+	for _, s := range engine.htmlSources {
+		if s.set != src.set {
+			sources = append(sources, s)
+		}
+	}
+	sources = append(sources, src)
+	r, err := parseHTML(sources, engine.funcMap)
+	if err != nil {
+		return err
+	}
+	engine.htmlSources = sources
+	engine.htmlRender = r
+	// 调试模式下模板文件变化时自动重新解析
+	if IsDebugging() {
+		stamp, err := htmlStamp(sources)
+		if err != nil {
+			return err
+		}
+		engine.htmlRender = &htmlDebugRender{engine: engine, templates: r, stamp: stamp}
+	}
+	return nil
+}
+
+// htmlDebugRender
+// @Description: 调试模式的 HTML 渲染器 每次渲染前检查模板文件的修改时间和大小 有变化时使用当前的 FuncMap 重新解析
+type htmlDebugRender struct {
+	engine    *Engine
+	mu        sync.Mutex
+	templates *HTMLTemplates
+	stamp     string
+}
+
+func (r *htmlDebugRender) Instance(name string, data interface{}) Render {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sources := r.engine.htmlSources
+	stamp, err := htmlStamp(sources)
+	if err != nil {
+		return errorRender{err: err}
+	}
+	if stamp != r.stamp {
+		templates, err := parseHTML(sources, r.engine.funcMap)
+		if err != nil {
+			// 修改中的模板可能有语法错误 直接返回错误 修复后再次重新解析
+			return errorRender{err: err}
+		}
+		debugPrint("templates reloaded")
+		r.templates, r.stamp = templates, stamp
+	}
+	return r.templates.Instance(name, data)
+}
+
+// htmlStamp 模板文件的路径、修改时间、大小 任意一个文件变化或增删文件时结果不同
+func htmlStamp(sources []htmlSource) (string, error) {
+	var b strings.Builder
+	for _, s := range sources {
+		files, err := s.files()
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			var info fs.FileInfo
+			if s.fsys != nil {
+				info, err = fs.Stat(s.fsys, file)
+			} else {
+				info, err = os.Stat(file)
+			}
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "%s|%d|%d\n", file, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return b.String(), nil
+}
+
+// htmlSource 一组模板文件的来源
+type htmlSource struct {
+	set      string   // 页面名称 为空时属于全局模板
+	layout   string   // 页面的布局文件
+	fsys     fs.FS    // 为 nil 时读取本地文件
+	glob     bool     // 本地文件时 patterns 是否为 glob
+	patterns []string // 文件名或 glob
+}
+
+// parse 将模板文件解析到 t 中
+func (s htmlSource) parse(t *template.Template, patterns ...string) (*template.Template, error) {
+	switch {
+	case s.fsys != nil:
+		return t.ParseFS(s.fsys, patterns...)
+	case !s.glob:
+		return t.ParseFiles(patterns...)
+	}
+	for _, pattern := range patterns {
+		if _, err := t.ParseGlob(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// files 列出全部模板文件 包括页面的布局文件
+func (s htmlSource) files() ([]string, error) {
+	var files []string
+	if s.layout != "" {
+		files = append(files, s.layout)
+	}
+	if s.fsys == nil && !s.glob {
+		return append(files, s.patterns...), nil
+	}
+	for _, pattern := range s.patterns {
+		var matches []string
+		var err error
+		if s.fsys != nil {
+			matches, err = fs.Glob(s.fsys, pattern)
+		} else {
+			matches, err = filepath.Glob(pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// parseHTML
+// @Description: 解析全部模板
+// @param sources
+// @param funcMap
+// @return *HTMLTemplates
+// @return error
+func parseHTML(sources []htmlSource, funcMap template.FuncMap) (*HTMLTemplates, error) {
+	r := &HTMLTemplates{Sets: make(map[string]*template.Template)}
+	for _, s := range sources {
+		if s.set == "" {
+			if r.Template == nil {
+				r.Template = template.New("").Funcs(funcMap)
+			}
+			if _, err := s.parse(r.Template, s.patterns...); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// 以布局文件的文件名作为页面的根模板
+		t := template.New(path.Base(s.layout)).Funcs(funcMap)
+		layout := s
+		layout.glob = false
+		if _, err := layout.parse(t, s.layout); err != nil {
+			return nil, fmt.Errorf("gee: html set %s: %w", s.set, err)
+		}
+		if len(s.patterns) > 0 {
+			if _, err := s.parse(t, s.patterns...); err != nil {
+				return nil, fmt.Errorf("gee: html set %s: %w", s.set, err)
+			}
+		}
+		r.Sets[s.set] = t
+	}
+	return r, nil
+}
+
+// combineHandlers
+// @Description: 按 根分组 -> 当前分组 的顺序拼接中间件 最后追加 handlers
+// @receiver group
+// @param handlers
+// @return []HandlerFunc
+func (group *RouterGroup) combineHandlers(handlers ...HandlerFunc) []HandlerFunc {
+	var groups []*RouterGroup
+	size := len(handlers)
+	for g := group; g != nil; g = g.parent {
+		groups = append(groups, g)
+		size += len(g.middlewares)
+	}
+	merged := make([]HandlerFunc, 0, size)
+	for i := len(groups) - 1; i >= 0; i-- {
+		merged = append(merged, groups[i].middlewares...)
+	}
+	return append(merged, handlers...)
 }
 
 // addRoute
 // @Description: 分组新增路由
+// @PS: 注册时就将分组及其父分组的中间件与 handler 拼接为完整的处理链 请求时不再逐个匹配分组
 // @receiver group
+// @PS: 路由自身的中间件在分组中间件之后执行 最后一个为路由的处理器
 // @param method
 // @param comp
-// @param handler
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+// @param handlers
+func (group *RouterGroup) addRoute(method string, comp string, handlers []HandlerFunc) {
+	if len(handlers) == 0 {
+		panic(fmt.Sprintf("gee: there must be at least one handler for %s %s", method, group.prefix+comp))
+	}
 	pattern := group.prefix + comp
-	log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	group.engine.router.addRoute(method, pattern, group.combineHandlers(handlers...))
+}
+
+// anyMethods Any 注册路由时使用的全部请求方法
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+	http.MethodConnect, http.MethodTrace,
+}
+
+// Handle
+// @Description: 以任意请求方法注册路由
+// @PS: GET/POST 等方法都是 Handle 的快捷方式 自定义的请求方法可以直接使用 Handle 注册
+// @receiver group
+// @param method
+// @param pattern
+// @param handlers
+func (group *RouterGroup) Handle(method string, pattern string, handlers ...HandlerFunc) {
+	if method == "" {
+		panic("gee: HTTP method can not be empty")
+	}
+	group.addRoute(method, pattern, handlers)
+}
+
+func (group *RouterGroup) GET(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodGet, pattern, handlers)
 }
 
-func (engine *Engine) GET(pattern string, handler HandlerFunc) {
-	engine.addRoute("GET", pattern, handler)
+func (group *RouterGroup) POST(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodPost, pattern, handlers)
 }
 
-func (engine *Engine) POST(pattern string, handler HandlerFunc) {
-	engine.addRoute("POST", pattern, handler)
+func (group *RouterGroup) PUT(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodPut, pattern, handlers)
 }
 
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+func (group *RouterGroup) PATCH(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodPatch, pattern, handlers)
 }
 
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouterGroup) DELETE(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodDelete, pattern, handlers)
+}
+
+// HEAD
+// @Description: 注册 HEAD 路由
+// @PS: 未注册 HEAD 路由时 HEAD 请求会自动交给同路径的 GET 处理器 并丢弃响应体
+// @receiver group
+// @param pattern
+// @param handlers
+func (group *RouterGroup) HEAD(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodHead, pattern, handlers)
+}
+
+func (group *RouterGroup) OPTIONS(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodOptions, pattern, handlers)
+}
+
+// Any
+// @Description: 为所有标准请求方法注册同一个路由
+// @receiver group
+// @param pattern
+// @param handlers
+func (group *RouterGroup) Any(pattern string, handlers ...HandlerFunc) {
+	for _, method := range anyMethods {
+		group.addRoute(method, pattern, handlers)
+	}
 }
 
 // Use
 // @Description: 为路由组添加中间件
+// @PS: 路由的处理链在注册时生成 中间件需要在注册路由之前添加
 // @receiver group
 // @param middlewares
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
+	if IsDebugging() {
+		for key := range group.engine.router.handlers {
+			if _, pattern := splitRouteKey(key); hasPathPrefix(pattern, group.prefix) {
+				debugPrint("[WARNING] Use() called on group %q after routes were registered, the middlewares do not apply to existing routes such as %s", group.prefix, key)
+				break
+			}
+		}
+	}
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
+// NoRoute
+// @Description: 设置路由不存在时的处理器 处理器之前依然会执行中间件
+// @PS: 在 Engine 上设置即为全局 404 在分组上设置则只对分组前缀下的路径生效 子分组未设置时使用父分组的
+// @receiver group
+// @param handlers
+func (group *RouterGroup) NoRoute(handlers ...HandlerFunc) {
+	group.noRoute = handlers
+}
+
+// NoMethod
+// @Description: 设置请求方法不匹配(405)时的处理器 需要开启 HandleMethodNotAllowed
+// @receiver engine
+// @param handlers
+func (engine *Engine) NoMethod(handlers ...HandlerFunc) {
+	engine.noMethod = handlers
+}
+
+// hasPathPrefix
+// @Description: 按路径片段判断 path 是否以 prefix 开头 例如 /v2 匹配 /v2/hello 但不匹配 /v2xyz
+// @param path
+// @param prefix
+// @return bool
+func hasPathPrefix(path string, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || prefix == "" || prefix[len(prefix)-1] == '/' || path[len(prefix)] == '/'
+}
+
+// matchGroup
+// @Description: 查找路径所属的分组 前缀最长的分组优先 没有匹配的分组时返回根分组
+// @receiver engine
+// @param path
+// @return *RouterGroup
+func (engine *Engine) matchGroup(path string) *RouterGroup {
+	matched := engine.RouterGroup
+	for _, group := range engine.groups {
+		if len(group.prefix) > len(matched.prefix) && hasPathPrefix(path, group.prefix) {
+			matched = group
+		}
+	}
+	return matched
+}
+
+// noRouteHandlers
+// @Description: 查找路径对应的 404 处理链
+// @PS: 使用所属分组的中间件 以及所属分组或最近的父分组设置的 NoRoute 处理器
+// @receiver engine
+// @param path
+// @return []HandlerFunc
+func (engine *Engine) noRouteHandlers(path string) []HandlerFunc {
+	group := engine.matchGroup(path)
+	for g := group; g != nil; g = g.parent {
+		if len(g.noRoute) > 0 {
+			return group.combineHandlers(g.noRoute...)
+		}
+	}
+	return group.combineHandlers(notFound)
+}
+
+// noMethodHandlers
+// @Description: 查找路径对应的 405 处理链
+// @receiver engine
+// @param path
+// @return []HandlerFunc
+func (engine *Engine) noMethodHandlers(path string) []HandlerFunc {
+	group := engine.matchGroup(path)
+	if len(engine.noMethod) == 0 {
+		return group.combineHandlers(methodNotAllowed)
+	}
+	return group.combineHandlers(engine.noMethod...)
+}
+
 // ServeHTTP
 // @Description: 实现 ServeHTTP
 // @receiver engine
 // @param w	 Response 返回
 // @param req Request 请求
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var middlewares []HandlerFunc
+	// 从对象池中取出 Context 请求结束后放回
+	c := engine.pool.Get().(*Context)
+	c.reset(w, req)
+	engine.router.handle(c)
+	// 处理器只设置了状态码而没有写入响应体时 在这里发送响应头
+	c.writermem.WriteHeaderNow()
+	engine.pool.Put(c)
+}
 
-	// 为当前路由的上下文 Context 添加中间件
-	for _, group := range engine.groups {
-		// 如果当前路由包含 路由组的前缀就将路由组的中间件添加到路由的 上下文中
-		// 匹配前缀的时候是连带 / 的
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
-			middlewares = append(middlewares, group.middlewares...)
-		}
+// allocateContext
+// @Description: 创建一个新的 Context 按路由中通配符的最大数量预分配 Params
+// @receiver engine
+// @return *Context
+func (engine *Engine) allocateContext() *Context {
+	return &Context{
+		Params: make(Params, 0, engine.router.maxParams),
+		engine: engine, // 注入 engine
 	}
-
-	c := newContext(w, req)
-	c.handlers = middlewares
-	c.engine = engine // 注入 engine
-	engine.router.handle(c)
 }
 
+// Run
+// @Description: 监听 addr 并处理请求 调试模式下先输出路由表
+// @receiver engine
+// @param addr
+// @return err
 func (engine *Engine) Run(addr string) (err error) {
+	debugPrintRoutes(engine.Routes())
+	debugPrint("Listening and serving HTTP on %s", addr)
 	return http.ListenAndServe(addr, engine)
 }
@@ -1,8 +1,13 @@
 package gee
 
 import (
-	"fmt"
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -16,8 +21,15 @@ PS D:\Go\src\GoFrame\gee> go test
 matched path: /hello/:name, params['name']: Bob
 PASS
 ok      gee     0.598s
+
+测试在 TestMode 下运行 不再输出路由和请求日志 需要查看时使用 go test -v
 */
 
+func TestMain(m *testing.M) {
+	SetMode(TestMode)
+	os.Exit(m.Run())
+}
+
 func newTestRoute() *router {
 	r := newRouter()
 	r.addRoute("GET", "/", nil)
@@ -49,9 +61,325 @@ func TestGetRoute(t *testing.T) {
 		t.Fatal("should match /hello/:name")
 	}
 
-	if ps["name"] != "Bob" {
+	if ps.ByName("name") != "Bob" {
 		t.Fatal("name should be equal to 'Bob' ")
 	}
 
-	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps["name"])
+	t.Logf("matched path: %s, params['name']: %s", n.pattern, ps.ByName("name"))
+}
+
+func TestHTTPMethods(t *testing.T) {
+	r := New()
+	methods := []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	r.GET("/res", func(c *Context) { c.String(http.StatusOK, "GET") })
+	r.POST("/res", func(c *Context) { c.String(http.StatusOK, "POST") })
+	r.PUT("/res", func(c *Context) { c.String(http.StatusOK, "PUT") })
+	r.PATCH("/res", func(c *Context) { c.String(http.StatusOK, "PATCH") })
+	r.DELETE("/res", func(c *Context) { c.String(http.StatusOK, "DELETE") })
+	r.OPTIONS("/res", func(c *Context) { c.String(http.StatusOK, "OPTIONS") })
+	r.Handle("PURGE", "/res", func(c *Context) { c.String(http.StatusOK, "PURGE") })
+	r.Any("/any", func(c *Context) { c.String(http.StatusOK, c.Method) })
+
+	for _, method := range append(methods, "PURGE") {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/res", nil))
+		if w.Code != http.StatusOK || w.Body.String() != method {
+			t.Fatalf("%s /res: got %d %q", method, w.Code, w.Body.String())
+		}
+	}
+	for _, method := range anyMethods {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/any", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s /any: got %d", method, w.Code)
+		}
+	}
+}
+
+func TestHeadFallback(t *testing.T) {
+	r := New()
+	r.GET("/hello", func(c *Context) {
+		c.SetHeader("X-Hello", "gee")
+		c.String(http.StatusOK, "hello")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/hello", nil))
+	if w.Code != http.StatusOK || w.Header().Get("X-Hello") != "gee" {
+		t.Fatalf("HEAD should fall back to GET, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("HEAD response body should be dropped, got %q", w.Body.String())
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", func(c *Context) {})
+	r.DELETE("/users/:id", func(c *Context) {})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/1", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS" {
+		t.Fatalf("unexpected Allow header %q", allow)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/users/1", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "DELETE, GET, HEAD, OPTIONS" {
+		t.Fatalf("unexpected OPTIONS reply %d %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/none", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 for unknown path, got %d", w.Code)
+	}
+
+	r.HandleMethodNotAllowed = false
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 when HandleMethodNotAllowed is off, got %d", w.Code)
+	}
+}
+
+func TestNoRouteAndNoMethod(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) { c.SetHeader("X-Global", "1") })
+	r.GET("/hello", func(c *Context) {})
+	r.NoRoute(func(c *Context) { c.String(http.StatusNotFound, "root") })
+	r.NoMethod(func(c *Context) { c.String(http.StatusMethodNotAllowed, "no method") })
+	api := r.Group("/api")
+	api.NoRoute(func(c *Context) { c.JSON(http.StatusNotFound, H{"message": "api"}) })
+
+	tests := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/none", "root", http.StatusNotFound},
+		{"GET", "/api/none", "{\"message\":\"api\"}\n", http.StatusNotFound},
+		{"POST", "/hello", "no method", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Fatalf("%s %s: got %d %q", tt.method, tt.path, w.Code, w.Body.String())
+		}
+		if w.Header().Get("X-Global") != "1" {
+			t.Fatalf("%s %s: global middleware should run", tt.method, tt.path)
+		}
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []string
+		panics bool
+	}{
+		{"param name conflict", []string{"/hello/:name", "/hello/:id"}, true},
+		{"nested param name conflict", []string{"/users/:id/posts", "/users/:uid/likes"}, true},
+		{"catch-all name conflict", []string{"/a/*x", "/a/*y"}, true},
+		{"catch-all not at end", []string{"/a/*x/b"}, true},
+		{"duplicate route", []string{"/hello", "/hello"}, true},
+		{"duplicate after parse", []string{"/hello", "/hello/"}, true},
+		{"unnamed param", []string{"/hello/:"}, true},
+		{"missing leading slash", []string{"hello"}, true},
+		{"same param name", []string{"/users/:id", "/users/:id/posts"}, false},
+		{"static beside param", []string{"/hello/:name", "/hello/b/c"}, false},
+		{"static beside catch-all", []string{"/a/*x", "/a/b/c"}, false},
+		{"param beside catch-all", []string{"/a/:x", "/a/*y"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); (err != nil) != tt.panics {
+					t.Fatalf("routes %v: panic = %v, want panic %v", tt.routes, err, tt.panics)
+				}
+			}()
+			r := newRouter()
+			for _, route := range tt.routes {
+				r.addRoute("GET", route, nil)
+			}
+		})
+	}
+
+	// 不同请求方法注册同一个 pattern 不算冲突
+	r := newRouter()
+	r.addRoute("GET", "/hello/:name", nil)
+	r.addRoute("POST", "/hello/:name", nil)
+}
+
+func TestMatchPriority(t *testing.T) {
+	routes := []string{"/hello/b", "/hello/:name", "/hello/*any", "/hello/:name/info", "/hello/b/c"}
+	tests := []struct {
+		path, pattern string
+	}{
+		{"/hello/b", "/hello/b"},
+		{"/hello/bob", "/hello/:name"},
+		{"/hello/b/info", "/hello/:name/info"}, // 静态节点 b 下无 info 回溯到 :name
+		{"/hello/b/c", "/hello/b/c"},
+		{"/hello/b/d", "/hello/*any"}, // 静态与参数均失败 回溯到 *any
+		{"/hello/x/y/z", "/hello/*any"},
+	}
+
+	// 正序与逆序注册 匹配结果应当一致
+	orders := [][]string{routes, make([]string, len(routes))}
+	for i, route := range routes {
+		orders[1][len(routes)-1-i] = route
+	}
+	for _, order := range orders {
+		r := newRouter()
+		for _, route := range order {
+			r.addRoute("GET", route, nil)
+		}
+		for _, tt := range tests {
+			n, _ := r.getRoute("GET", tt.path)
+			if n == nil || n.pattern != tt.pattern {
+				t.Fatalf("routes %v: %s should match %s, got %v", order, tt.path, tt.pattern, n)
+			}
+		}
+	}
+}
+
+func TestGroupMiddlewareChain(t *testing.T) {
+	r := New()
+	trace := func(name string) HandlerFunc {
+		return func(c *Context) {
+			c.Writer.Header().Add("X-Trace", name)
+		}
+	}
+	r.Use(trace("global"))
+	v2 := r.Group("/v2")
+	v2.Use(trace("v2"))
+	admin := v2.Group("/admin")
+	admin.Use(trace("admin"))
+	admin.GET("/users", func(c *Context) { c.String(http.StatusOK, c.Path) })
+	r.GET("/v2xyz", func(c *Context) { c.String(http.StatusOK, c.Path) })
+
+	tests := []struct {
+		path  string
+		trace []string
+	}{
+		{"/admin/users", []string{"global", "v2", "admin"}},
+		{"/v2xyz", []string{"global"}},
+		{"/v2/none", []string{"global", "v2"}}, // 404 也要走所属分组的中间件
+		{"/v2xyz/none", []string{"global"}},    // 按路径片段匹配分组
+		{"/admin", []string{"global", "v2", "admin"}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := w.Header()["X-Trace"]; !reflect.DeepEqual(got, tt.trace) {
+			t.Fatalf("%s: middlewares %v, want %v", tt.path, got, tt.trace)
+		}
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	r := New()
+	var order []string
+	trace := func(name string) HandlerFunc {
+		return func(c *Context) {
+			order = append(order, name)
+		}
+	}
+	r.Use(trace("global"))
+	v1 := r.Group("/v1")
+	v1.Use(trace("v1"))
+	v1.GET("/admin", trace("auth"), trace("limit"), trace("handler"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin", nil))
+	if want := []string{"global", "v1", "auth", "limit", "handler"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("handlers run in %v, want %v", order, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a route without handlers should panic")
+		}
+	}()
+	r.GET("/empty")
+}
+
+func testIndexHandler(c *Context) {}
+
+func TestRoutesAndModes(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetMode(TestMode)
+
+	SetMode("")
+	if Mode() != DebugMode || !IsDebugging() {
+		t.Fatalf("empty mode should be debug, got %s", Mode())
+	}
+	r := Default()
+	api := r.Group("/api")
+	api.Use(func(c *Context) {})
+	api.GET("/users/:id", testIndexHandler)
+	r.POST("/login", func(c *Context) {})
+	r.Handle("M-SEARCH", "/upnp", testIndexHandler)
+	api.Use(func(c *Context) {})
+
+	routes := r.Routes()
+	if len(routes) != 3 {
+		t.Fatalf("routes = %v", routes)
+	}
+	if routes[0].Method != http.MethodGet || routes[0].Path != "/api/users/:id" ||
+		routes[0].Handler != "gee.testIndexHandler" || routes[0].Middlewares != 3 {
+		t.Fatalf("route = %+v", routes[0])
+	}
+	if routes[1].Path != "/login" || routes[1].Middlewares != 2 || !strings.HasPrefix(routes[1].Handler, "gee.TestRoutesAndModes.func") {
+		t.Fatalf("route = %+v", routes[1])
+	}
+	if routes[2].Method != "M-SEARCH" || routes[2].Path != "/upnp" {
+		t.Fatalf("route = %+v", routes[2])
+	}
+
+	debugPrintRoutes(routes)
+	out := buf.String()
+	for _, want := range []string{
+		`Running in "debug" mode`,
+		"Logger and Recovery middleware already attached",
+		`Use() called on group "/api" after routes were registered`,
+		"3 routes registered",
+		"METHOD    PATH            HANDLER",
+		"GET       /api/users/:id  gee.testIndexHandler",
+		"M-SEARCH  /upnp           gee.testIndexHandler",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("debug output should contain %q:\n%s", want, out)
+		}
+	}
+
+	// 发布模式与测试模式不输出调试信息
+	for _, mode := range []string{ReleaseMode, TestMode} {
+		buf.Reset()
+		SetMode(mode)
+		r := Default()
+		r.GET("/", testIndexHandler)
+		r.Use(func(c *Context) {})
+		debugPrintRoutes(r.Routes())
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if mode == TestMode && buf.Len() != 0 {
+			t.Errorf("%s mode should be silent, got %q", mode, buf.String())
+		}
+		if mode == ReleaseMode && strings.Contains(buf.String(), "GEE-debug") {
+			t.Errorf("%s mode should not print debug messages, got %q", mode, buf.String())
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unknown mode should panic")
+		}
+	}()
+	SetMode("production")
 }
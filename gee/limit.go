@@ -0,0 +1,64 @@
+package gee
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge 请求体超过 BodyLimit 设置的大小
+var ErrBodyTooLarge = errors.New("gee: request body too large")
+
+// limitedBody
+// @Description: 限制读取大小的请求体 超出限制后 Read 返回 ErrBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	// 多读一个字节 用于判断是否超出限制
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		b.exceeded = true
+		return int(b.remaining), ErrBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// BodyLimit
+// @Description: 限制请求体大小的中间件 可以用于单个路由 例如 r.POST("/upload", gee.BodyLimit(8<<20), upload)
+// @PS: Content-Length 超出限制时直接返回 413
+// @PS: 未声明长度的请求体在读取超出限制时返回 ErrBodyTooLarge FormFile、MultipartForm 会原样返回该错误
+// @PS: 处理函数读取超出限制后没有写入响应时 由中间件返回 413
+// @param limit	允许的最大字节数
+// @return HandlerFunc
+func BodyLimit(limit int64) HandlerFunc {
+	return func(c *Context) {
+		if c.Req.ContentLength > limit {
+			c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if c.Req.Body != nil && c.Req.Body != http.NoBody {
+			c.Req.Body = &limitedBody{ReadCloser: c.Req.Body, remaining: limit}
+		}
+		c.Next()
+		if bodyTooLarge(c.Req) && !c.Writer.Written() {
+			c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		}
+	}
+}
+
+// bodyTooLarge 请求体是否因为超出 BodyLimit 而读取失败
+func bodyTooLarge(req *http.Request) bool {
+	body, ok := req.Body.(*limitedBody)
+	return ok && body.exceeded
+}
@@ -11,7 +11,10 @@ func Logger() HandlerFunc {
 		t := time.Now()
 		// Process request
 		c.Next()
-		// 记录日志
-		log.Printf("[%d] %s in %v for group v2-logger", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		// 记录日志 测试模式下不输出
+		if Mode() == TestMode {
+			return
+		}
+		log.Printf("[%d] %s in %v for group v2-logger", c.Writer.Status(), c.Req.RequestURI, time.Since(t))
 	}
 }
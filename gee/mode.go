@@ -0,0 +1,47 @@
+package gee
+
+import "os"
+
+// EnvGeeMode 设置运行模式的环境变量
+const EnvGeeMode = "GEE_MODE"
+
+// 运行模式
+const (
+	// DebugMode 默认模式 打印路由表和警告 模板文件修改后自动重新解析
+	DebugMode = "debug"
+	// ReleaseMode 生产环境使用 不打印调试信息 模板只解析一次
+	ReleaseMode = "release"
+	// TestMode 用于 go test 同 ReleaseMode 并且关闭 Logger 中间件的日志
+	TestMode = "test"
+)
+
+var geeMode = DebugMode
+
+func init() {
+	SetMode(os.Getenv(EnvGeeMode))
+}
+
+// SetMode
+// @Description: 设置运行模式 需要在创建 Engine、加载模板之前调用
+// @PS: 程序启动时会读取环境变量 GEE_MODE
+// @param value	DebugMode、ReleaseMode 或 TestMode 为空时使用 DebugMode
+func SetMode(value string) {
+	switch value {
+	case "":
+		geeMode = DebugMode
+	case DebugMode, ReleaseMode, TestMode:
+		geeMode = value
+	default:
+		panic("gee: unknown mode " + value + ", available modes: debug release test")
+	}
+}
+
+// Mode 当前的运行模式
+func Mode() string {
+	return geeMode
+}
+
+// IsDebugging 是否为调试模式
+func IsDebugging() bool {
+	return geeMode == DebugMode
+}
@@ -0,0 +1,403 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Render
+// @Description: 响应渲染器 Context.Render 先写入 Content-Type 再调用 Render 写入响应体
+type Render interface {
+	// Render 将数据写入响应体
+	Render(w http.ResponseWriter) error
+	// WriteContentType 设置 Content-Type 已经设置过时不覆盖
+	WriteContentType(w http.ResponseWriter)
+}
+
+const (
+	jsonContentType         = "application/json; charset=utf-8"
+	jsonpContentType        = "application/javascript; charset=utf-8"
+	xmlContentType          = "application/xml; charset=utf-8"
+	yamlContentType         = "application/x-yaml; charset=utf-8"
+	plainContentType        = "text/plain; charset=utf-8"
+	htmlContentType         = "text/html; charset=utf-8"
+	defaultSecureJSONPrefix = "while(1);"
+)
+
+// writeContentType 设置 Content-Type 已经设置过时不覆盖
+func writeContentType(w http.ResponseWriter, value string) {
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", value)
+	}
+}
+
+// encodeJSON 编码为 JSON 末尾带换行符 escapeHTML 为 false 时保留 <、>、& 原样输出
+func encodeJSON(obj interface{}, indent bool, escapeHTML bool) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(escapeHTML)
+	if indent {
+		encoder.SetIndent("", "    ")
+	}
+	// 先完整编码再写入 编码失败时不会写出半个响应体
+	if err := encoder.Encode(obj); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// JSONRender 普通 JSON <、>、& 会被转义为 \u003c 等
+type JSONRender struct {
+	Data interface{}
+}
+
+func (r JSONRender) Render(w http.ResponseWriter) error {
+	data, err := encodeJSON(r.Data, false, true)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r JSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// IndentedJSONRender 带缩进的 JSON 便于阅读
+type IndentedJSONRender struct {
+	Data interface{}
+}
+
+func (r IndentedJSONRender) Render(w http.ResponseWriter) error {
+	data, err := encodeJSON(r.Data, true, true)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r IndentedJSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// PureJSONRender 不转义 HTML 字符的 JSON
+type PureJSONRender struct {
+	Data interface{}
+}
+
+func (r PureJSONRender) Render(w http.ResponseWriter) error {
+	data, err := encodeJSON(r.Data, false, false)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r PureJSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// SecureJSONRender 数据为数组时在前面加上前缀 防止 JSON 劫持
+type SecureJSONRender struct {
+	Prefix string
+	Data   interface{}
+}
+
+func (r SecureJSONRender) Render(w http.ResponseWriter) error {
+	data, err := encodeJSON(r.Data, false, true)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("[")) && bytes.HasSuffix(bytes.TrimSpace(data), []byte("]")) {
+		if _, err = w.Write([]byte(r.Prefix)); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r SecureJSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// ErrInvalidJSONPCallback JSONP 回调函数名不是合法的 JavaScript 标识符
+var ErrInvalidJSONPCallback = errors.New("gee: invalid JSONP callback")
+
+// jsonpCallbackPattern 回调函数名只允许由点号连接的标识符 例如 cb、jQuery.cb_1
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+// JSONPRender 使用回调函数包裹 JSON 回调函数为空时输出普通 JSON
+type JSONPRender struct {
+	Callback string
+	Data     interface{}
+}
+
+func (r JSONPRender) Render(w http.ResponseWriter) error {
+	data, err := encodeJSON(r.Data, false, true)
+	if err != nil {
+		return err
+	}
+	if r.Callback == "" {
+		_, err = w.Write(data)
+		return err
+	}
+	if !jsonpCallbackPattern.MatchString(r.Callback) {
+		return ErrInvalidJSONPCallback
+	}
+	_, err = fmt.Fprintf(w, "%s(%s);", r.Callback, bytes.TrimSpace(data))
+	return err
+}
+
+func (r JSONPRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonpContentType)
+}
+
+// XMLRender XML 编码
+type XMLRender struct {
+	Data interface{}
+}
+
+func (r XMLRender) Render(w http.ResponseWriter) error {
+	data, err := xml.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r XMLRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, xmlContentType)
+}
+
+// YAMLRender YAML 编码 见 marshalYAML
+type YAMLRender struct {
+	Data interface{}
+}
+
+func (r YAMLRender) Render(w http.ResponseWriter) error {
+	data, err := marshalYAML(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r YAMLRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, yamlContentType)
+}
+
+// HTMLRenderer
+// @Description: HTML 渲染器 根据模板名和数据生成 Render
+type HTMLRenderer interface {
+	Instance(name string, data interface{}) Render
+}
+
+// HTMLTemplates
+// @Description: 默认的 HTML 渲染器 优先使用同名的页面 否则执行全局模板中的同名模板
+type HTMLTemplates struct {
+	Template *template.Template            // LoadHTMLGlob 等加载的全局模板
+	Sets     map[string]*template.Template // 页面名称 -> 布局与内容 从根模板开始执行
+}
+
+func (r *HTMLTemplates) Instance(name string, data interface{}) Render {
+	if set, ok := r.Sets[name]; ok {
+		return HTMLRender{Template: set, Name: set.Name(), Data: data}
+	}
+	return HTMLRender{Template: r.Template, Name: name, Data: data}
+}
+
+// HTMLRender 执行 Template 中名为 Name 的模板
+type HTMLRender struct {
+	Template *template.Template
+	Name     string
+	Data     interface{}
+}
+
+func (r HTMLRender) Render(w http.ResponseWriter) error {
+	if r.Template == nil {
+		return errors.New("gee: html templates are not loaded")
+	}
+	return r.Template.ExecuteTemplate(w, r.Name, r.Data)
+}
+
+func (r HTMLRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, htmlContentType)
+}
+
+// StringRender 格式化字符串
+type StringRender struct {
+	Format string
+	Data   []interface{}
+}
+
+func (r StringRender) Render(w http.ResponseWriter) (err error) {
+	if len(r.Data) > 0 {
+		_, err = fmt.Fprintf(w, r.Format, r.Data...)
+		return
+	}
+	_, err = w.Write([]byte(r.Format))
+	return
+}
+
+func (r StringRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, plainContentType)
+}
+
+// DataRender 原始数据 ContentType 为空时不设置
+type DataRender struct {
+	ContentType string
+	Data        []byte
+}
+
+func (r DataRender) Render(w http.ResponseWriter) error {
+	_, err := w.Write(r.Data)
+	return err
+}
+
+func (r DataRender) WriteContentType(w http.ResponseWriter) {
+	if r.ContentType != "" {
+		writeContentType(w, r.ContentType)
+	}
+}
+
+// ReaderRender 将 Reader 中的数据写入响应 ContentLength 小于 0 时不设置 Content-Length
+type ReaderRender struct {
+	ContentType   string
+	ContentLength int64
+	Headers       map[string]string
+	Reader        io.Reader
+}
+
+func (r ReaderRender) Render(w http.ResponseWriter) error {
+	header := w.Header()
+	for key, value := range r.Headers {
+		header.Set(key, value)
+	}
+	if r.ContentLength >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	}
+	_, err := io.Copy(w, r.Reader)
+	return err
+}
+
+func (r ReaderRender) WriteContentType(w http.ResponseWriter) {
+	if r.ContentType != "" {
+		writeContentType(w, r.ContentType)
+	}
+}
+
+// errorRender 直接返回 err 由 Context.Render 响应 500
+type errorRender struct {
+	err error
+}
+
+func (r errorRender) Render(http.ResponseWriter) error {
+	return r.err
+}
+
+func (r errorRender) WriteContentType(http.ResponseWriter) {}
+
+// bodyAllowedForStatus 状态码是否允许携带响应体
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// Negotiate
+// @Description: 内容协商的配置 根据 Accept 从 Offered 中选择响应格式
+type Negotiate struct {
+	Offered  []string    // 可以提供的格式 支持 MIMEJSON、MIMEXML、MIMEYAML、MIMEHTML、MIMEPlain
+	HTMLName string      // HTML 模板名
+	HTMLData interface{} // 以下数据未设置时使用 Data
+	JSONData interface{}
+	XMLData  interface{}
+	YAMLData interface{}
+	Data     interface{}
+}
+
+// acceptItem Accept 中的一项
+type acceptItem struct {
+	mime string
+	q    float64
+}
+
+// parseAccept
+// @Description: 解析 Accept 头 按 q 值从高到低排序 q 值相同时保持原有顺序
+// @param accept	例如 text/html, application/xml;q=0.9, */*;q=0.8
+// @return []string	可以接受的类型
+// @return map[string]bool	q=0 明确拒绝的类型 通配符匹配时需要跳过
+func parseAccept(accept string) ([]string, map[string]bool) {
+	items := make([]acceptItem, 0, 4)
+	var refused map[string]bool
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mime := strings.TrimSpace(params[0])
+		if mime == "" {
+			continue
+		}
+		if q := acceptQuality(params[1:]); q > 0 {
+			items = append(items, acceptItem{mime: mime, q: q})
+		} else {
+			if refused == nil {
+				refused = make(map[string]bool)
+			}
+			refused[mime] = true
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	mimes := make([]string, len(items))
+	for i, item := range items {
+		mimes[i] = item.mime
+	}
+	return mimes, refused
+}
+
+// acceptQuality 读取 Accept 类请求头中一项的 q 值 默认为 1
+func acceptQuality(params []string) float64 {
+	for _, param := range params {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				return q
+			}
+		}
+	}
+	return 1
+}
+
+// matchMIME accepted 是否包含 offer 支持 */* 与 text/* 形式的通配符
+func matchMIME(accepted string, offer string) bool {
+	if accepted == "*/*" || accepted == offer {
+		return true
+	}
+	if strings.HasSuffix(accepted, "/*") {
+		return strings.HasPrefix(offer, accepted[:len(accepted)-1])
+	}
+	return false
+}
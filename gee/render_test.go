@@ -0,0 +1,384 @@
+package gee
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type renderUser struct {
+	Name string   `json:"name" xml:"name" yaml:"name"`
+	Tags []string `json:"tags" xml:"tag" yaml:"tags,omitempty"`
+}
+
+func TestRenderers(t *testing.T) {
+	r := New()
+	r.SecureJSONPrefix(")]}',\n")
+	user := renderUser{Name: "<geektutu>", Tags: []string{"go"}}
+	r.GET("/json", func(c *Context) { c.JSON(http.StatusOK, user) })
+	r.GET("/pure", func(c *Context) { c.PureJSON(http.StatusOK, user) })
+	r.GET("/indented", func(c *Context) { c.IndentedJSON(http.StatusOK, H{"a": 1}) })
+	r.GET("/secure", func(c *Context) { c.SecureJSON(http.StatusOK, []int{1, 2}) })
+	r.GET("/jsonp", func(c *Context) { c.JSONP(http.StatusOK, H{"a": 1}) })
+	r.GET("/xml", func(c *Context) { c.XML(http.StatusOK, user) })
+	r.GET("/xmlh", func(c *Context) {
+		c.XML(http.StatusOK, H{"name": "<gee>", "age": 1, "tags": []string{"go", "web"}, "meta": H{"v": 2}})
+	})
+	r.GET("/yaml", func(c *Context) { c.YAML(http.StatusOK, user) })
+	r.GET("/string", func(c *Context) { c.String(http.StatusOK, "100%") })
+	r.GET("/nocontent", func(c *Context) { c.JSON(http.StatusNoContent, user) })
+	r.GET("/fail", func(c *Context) { c.JSON(http.StatusOK, make(chan int)) })
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/json", 200, jsonContentType, "{\"name\":\"\\u003cgeektutu\\u003e\",\"tags\":[\"go\"]}\n"},
+		{"/pure", 200, jsonContentType, "{\"name\":\"<geektutu>\",\"tags\":[\"go\"]}\n"},
+		{"/indented", 200, jsonContentType, "{\n    \"a\": 1\n}\n"},
+		{"/secure", 200, jsonContentType, ")]}',\n[1,2]\n"},
+		{"/jsonp?callback=cb", 200, jsonpContentType, "cb({\"a\":1});"},
+		{"/jsonp", 200, jsonContentType, "{\"a\":1}\n"},
+		{"/jsonp?callback=jQuery.cb_1", 200, jsonpContentType, "jQuery.cb_1({\"a\":1});"},
+		{"/jsonp?callback=alert(document.domain)//", 400, jsonContentType, "{\"message\":\"gee: invalid JSONP callback\"}\n"},
+		{"/xml", 200, xmlContentType, "<renderUser><name>&lt;geektutu&gt;</name><tag>go</tag></renderUser>"},
+		{"/xmlh", 200, xmlContentType, "<H><age>1</age><meta><v>2</v></meta><name>&lt;gee&gt;</name><tags>go</tags><tags>web</tags></H>"},
+		{"/yaml", 200, yamlContentType, "name: <geektutu>\ntags:\n  - go\n"},
+		{"/string", 200, plainContentType, "100%"},
+		{"/nocontent", 204, jsonContentType, ""},
+		{"/fail", 500, jsonContentType, "{\"message\":\"json: unsupported type: chan int\"}\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code || w.Header().Get("Content-Type") != tt.contentType || w.Body.String() != tt.body {
+			t.Errorf("GET %s = %d %q %q, want %d %q %q", tt.path,
+				w.Code, w.Header().Get("Content-Type"), w.Body.String(), tt.code, tt.contentType, tt.body)
+		}
+	}
+}
+
+type yamlAddress struct {
+	City string `yaml:"city"`
+}
+
+type yamlBase struct {
+	ID int64 `yaml:"id"`
+}
+
+type yamlUser struct {
+	yamlBase
+	Name     string
+	Nick     string `yaml:",omitempty"`
+	Ignored  string `yaml:"-"`
+	Active   bool   `yaml:"active"`
+	Score    float64
+	Created  time.Time
+	Address  *yamlAddress
+	Missing  *yamlAddress
+	Friends  []yamlAddress
+	Empty    []string
+	Labels   map[string]interface{}
+	internal int
+}
+
+func TestMarshalYAML(t *testing.T) {
+	user := yamlUser{
+		yamlBase: yamlBase{ID: 1},
+		Name:     "yes",
+		Active:   true,
+		Score:    1.5,
+		Created:  time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		Address:  &yamlAddress{City: "a: b"},
+		Friends:  []yamlAddress{{City: "x"}, {City: "y"}},
+		Labels:   map[string]interface{}{"b": []int{1, 2}, "a": "1", "c": nil},
+		internal: 1,
+	}
+	want := `id: 1
+name: "yes"
+active: true
+score: 1.5
+created: 2021-01-02T03:04:05Z
+address:
+  city: "a: b"
+missing: null
+friends:
+  - city: x
+  - city: "y"
+empty: []
+labels:
+  a: "1"
+  b:
+    - 1
+    - 2
+  c: null
+`
+	data, err := marshalYAML(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Fatalf("marshalYAML() =\n%s\nwant\n%s", data, want)
+	}
+
+	// 可能被解析为数字、时间等其他类型的字符串需要加引号
+	scalars := []struct {
+		value interface{}
+		want  string
+	}{
+		{"0x1F", `"0x1F"`},
+		{"0o17", `"0o17"`},
+		{"0b101", `"0b101"`},
+		{"1_000", `"1_000"`},
+		{"0xFFFFFFFFFFFFFFFFFF", `"0xFFFFFFFFFFFFFFFFFF"`},
+		{".inf", `".inf"`},
+		{"-.Inf", `"-.Inf"`},
+		{".NaN", `".NaN"`},
+		{"2024-01-01", `"2024-01-01"`},
+		{"2024-1-1 12:00:00", `"2024-1-1 12:00:00"`},
+		{"0xgg", "0xgg"},
+		{"v2024-01-01", "v2024-01-01"},
+		{[]byte("gee"), "!!binary Z2Vl"},
+		{[]byte{}, `!!binary ""`},
+	}
+	for _, tt := range scalars {
+		data, err := marshalYAML(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want+"\n" {
+			t.Errorf("marshalYAML(%q) = %q, want %q", tt.value, data, tt.want+"\n")
+		}
+	}
+	if _, err := marshalYAML(H{"f": func() {}}); err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	r := New()
+	r.GET("/user", func(c *Context) {
+		c.Negotiate(http.StatusOK, Negotiate{
+			Offered: []string{MIMEJSON, MIMEXML, MIMEYAML},
+			Data:    renderUser{Name: "geektutu"},
+		})
+	})
+	r.GET("/h", func(c *Context) {
+		c.Negotiate(http.StatusOK, Negotiate{Offered: []string{MIMEJSON, MIMEXML}, Data: H{"name": "geektutu"}})
+	})
+
+	tests := []struct {
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"", 200, jsonContentType},
+		{"application/xml", 200, xmlContentType},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", 200, xmlContentType},
+		{"application/json;q=0.5, application/x-yaml", 200, yamlContentType},
+		{"application/*", 200, jsonContentType},
+		{"application/xml;q=0, */*", 200, jsonContentType},
+		{"text/html", 406, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("Accept %q = %d %q, want %d %q", tt.accept, w.Code, w.Header().Get("Content-Type"), tt.code, tt.contentType)
+		}
+	}
+
+	// H 同样可以按 XML 返回
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/h", nil)
+	req.Header.Set("Accept", "application/xml")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "<H><name>geektutu</name></H>" {
+		t.Fatalf("Accept application/xml = %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	c := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil)}
+	c.Req.Header.Set("Accept", "text/*;q=0.5, application/xml")
+	if got := c.NegotiateFormat(MIMEPlain, MIMEXML); got != MIMEXML {
+		t.Fatalf("NegotiateFormat() = %q, want %q", got, MIMEXML)
+	}
+	if got := c.NegotiateFormat(MIMEPlain, MIMEJSON); got != MIMEPlain {
+		t.Fatalf("NegotiateFormat() = %q, want %q", got, MIMEPlain)
+	}
+	if got := c.NegotiateFormat(MIMEJSON); got != "" {
+		t.Fatalf("NegotiateFormat() = %q, want empty", got)
+	}
+	c.Req.Header.Set("Accept", "application/xml;q=0, */*")
+	if got := c.NegotiateFormat(MIMEXML, MIMEJSON); got != MIMEJSON {
+		t.Fatalf("NegotiateFormat() = %q, want %q", got, MIMEJSON)
+	}
+	if got := c.NegotiateFormat(MIMEXML); got != "" {
+		t.Fatalf("NegotiateFormat() = %q, want empty", got)
+	}
+}
+
+func TestHTMLTemplates(t *testing.T) {
+	pages := fstest.MapFS{
+		"layouts/base.tmpl":   {Data: []byte(`<title>{{block "title" .}}gee{{end}}</title>{{block "content" .}}{{end}}`)},
+		"partials/hello.tmpl": {Data: []byte(`{{define "hello"}}hello, {{.name | upper}}{{end}}`)},
+		"home.tmpl":           {Data: []byte(`{{define "content"}}{{template "hello" .}}{{end}}`)},
+		"about.tmpl":          {Data: []byte(`{{define "title"}}about{{end}}{{define "content"}}about {{.name}}{{end}}`)},
+		"plain.tmpl":          {Data: []byte(`plain {{.name}}`)},
+	}
+
+	r := New()
+	r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	if err := r.LoadHTMLFS(pages, "plain.tmpl", "partials/*.tmpl"); err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range []string{"home.tmpl", "about.tmpl"} {
+		if err := r.AddHTMLSetFS(page, pages, "layouts/base.tmpl", "partials/*.tmpl", page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.GET("/:page", func(c *Context) {
+		c.HTML(http.StatusOK, c.Param("page"), H{"name": "geektutu"})
+	})
+
+	tests := []struct {
+		page string
+		code int
+		body string
+	}{
+		{"home.tmpl", 200, "<title>gee</title>hello, GEEKTUTU"},
+		{"about.tmpl", 200, "<title>about</title>about geektutu"},
+		{"plain.tmpl", 200, "plain geektutu"},
+		{"hello", 200, "hello, GEEKTUTU"},
+		{"missing.tmpl", 500, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.page, nil))
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.page, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+		if tt.code == 200 && w.Header().Get("Content-Type") != htmlContentType {
+			t.Errorf("GET %s Content-Type = %q", tt.page, w.Header().Get("Content-Type"))
+		}
+	}
+
+	// 解析失败时返回错误 并保留原来的模板
+	if err := r.AddHTMLSetFS("home.tmpl", fstest.MapFS{"bad.tmpl": {Data: []byte("{{")}}, "bad.tmpl"); err == nil {
+		t.Fatal("expect error for invalid template")
+	}
+	if err := r.LoadHTMLGlob(filepath.Join(t.TempDir(), "*.tmpl")); err == nil {
+		t.Fatal("expect error for pattern matching no files")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/home.tmpl", nil))
+	if w.Body.String() != "<title>gee</title>hello, GEEKTUTU" {
+		t.Fatalf("templates changed after failed load: %q", w.Body.String())
+	}
+}
+
+func TestLoadHTMLFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.tmpl"), []byte(`a {{.}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "b.tmpl"), []byte(`b {{.}}`), 0644)
+
+	r := New()
+	r.GET("/", func(c *Context) { c.HTML(http.StatusOK, "b.tmpl", "<x>") })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expect 500 before templates are loaded, got %d", w.Code)
+	}
+
+	if err := r.LoadHTMLFiles(filepath.Join(dir, "a.tmpl"), filepath.Join(dir, "b.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Body.String() != "b &lt;x&gt;" {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+	if err := r.LoadHTMLFiles(filepath.Join(dir, "missing.tmpl")); err == nil {
+		t.Fatal("expect error for missing file")
+	}
+}
+
+func TestHTMLReload(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.tmpl")
+	write := func(content string, age time.Duration) {
+		if err := os.WriteFile(page, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// 保证修改时间不同
+		modtime := time.Now().Add(-age)
+		os.Chtimes(page, modtime, modtime)
+	}
+	render := func(r *Engine) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code, w.Body.String()
+	}
+	newEngine := func() *Engine {
+		r := New()
+		r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+		if err := r.LoadHTMLGlob(filepath.Join(dir, "*.tmpl")); err != nil {
+			t.Fatal(err)
+		}
+		r.GET("/", func(c *Context) { c.HTML(http.StatusOK, "page.tmpl", "gee") })
+		return r
+	}
+	// debug 模式会打印路由和模板重新加载的日志
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetMode(Mode())
+
+	write("v1 {{upper .}}", time.Hour)
+	SetMode(ReleaseMode)
+	release := newEngine()
+	SetMode(DebugMode)
+	debug := newEngine()
+
+	write("v2 {{upper .}}", 0)
+	if _, body := render(release); body != "v1 GEE" {
+		t.Fatalf("release mode should parse templates once, got %q", body)
+	}
+	if _, body := render(debug); body != "v2 GEE" {
+		t.Fatalf("debug mode should reload templates, got %q", body)
+	}
+
+	// 语法错误时返回 500 修复后恢复
+	write("v3 {{upper .", time.Minute)
+	if code, _ := render(debug); code != http.StatusInternalServerError {
+		t.Fatalf("expect 500 for invalid template, got %d", code)
+	}
+	write("v4 {{upper .}}", 2*time.Minute)
+	if _, body := render(debug); body != "v4 GEE" {
+		t.Fatalf("body = %q", body)
+	}
+
+	// 新增的文件也会被加载
+	os.WriteFile(filepath.Join(dir, "other.tmpl"), []byte(`other {{upper .}}`), 0644)
+	debug.GET("/other", func(c *Context) { c.HTML(http.StatusOK, "other.tmpl", "gee") })
+	w := httptest.NewRecorder()
+	debug.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other", nil))
+	if w.Body.String() != "other GEE" {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+}
@@ -0,0 +1,123 @@
+package gee
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// noWritten 响应头尚未写入时 size 的值
+const noWritten = -1
+
+// ResponseWriter
+// @Description: 包装 http.ResponseWriter 记录状态码、响应体大小以及是否已经写入
+// @PS: 状态码在第一次写入响应体(或 WriteHeaderNow)时才真正发送 在此之前可以多次修改 之后的修改会被忽略
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+
+	// Status 响应状态码 默认为 200
+	Status() int
+	// Size 已经写入的响应体字节数 尚未写入时为 -1
+	Size() int
+	// Written 响应头是否已经发送
+	Written() bool
+	// WriteHeaderNow 立即发送响应头
+	WriteHeaderNow()
+	// WriteString 写入字符串
+	WriteString(s string) (int, error)
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	size   int
+	status int
+}
+
+var _ ResponseWriter = (*responseWriter)(nil)
+
+// reset 重置以便随 Context 一起复用
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.size = noWritten
+	w.status = http.StatusOK
+}
+
+// WriteHeader
+// @Description: 设置状态码 只有在响应头发送之前有效
+// @receiver w
+// @param code
+func (w *responseWriter) WriteHeader(code int) {
+	if code > 0 && w.status != code {
+		if w.Written() {
+			debugPrint("[WARNING] Headers were already written. Wanted to override status code %d with %d", w.status, code)
+			return
+		}
+		w.status = code
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = w.ResponseWriter.Write(data)
+	w.size += n
+	return
+}
+
+func (w *responseWriter) WriteString(s string) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = io.WriteString(w.ResponseWriter, s)
+	w.size += n
+	return
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+// Flush 发送响应头以及已经缓冲的数据
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 接管底层连接 之后的响应由调用方自行写入
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("gee: response writer does not implement http.Hijacker")
+	}
+	if w.size < 0 {
+		w.size = 0
+	}
+	return hijacker.Hijack()
+}
+
+// Push HTTP/2 服务端推送 不支持时返回 http.ErrNotSupported
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -1,19 +1,22 @@
 package gee
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 )
 
 type router struct {
-	roots    map[string]*node
-	handlers map[string]HandlerFunc
+	maxParams int // 所有路由中通配符数量的最大值 用于预分配 Context.Params
+	roots     map[string]*node
+	handlers  map[string][]HandlerFunc // 路由的完整处理链 包含分组中间件
 }
 
 func newRouter() *router {
 	return &router{
 		roots:    make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
+		handlers: make(map[string][]HandlerFunc),
 	}
 }
 
@@ -36,75 +39,224 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
+// checkPattern
+// @Description: 检查路由 pattern 是否合法 不合法时 panic
+// @param pattern
+func checkPattern(pattern string) {
+	if pattern == "" || pattern[0] != '/' {
+		panic(fmt.Sprintf("gee: path must begin with '/' in path '%s'", pattern))
+	}
+	catchAll := ""
+	for _, item := range strings.Split(pattern, "/") {
+		if item == "" {
+			continue
+		}
+		// 通配符之后还有内容 会被 parsePattern 截断
+		if catchAll != "" {
+			panic(fmt.Sprintf("gee: catch-all '%s' is only allowed at the end of path '%s'", catchAll, pattern))
+		}
+		if item == ":" {
+			panic(fmt.Sprintf("gee: wildcards must be named in path '%s'", pattern))
+		}
+		if item[0] == '*' {
+			catchAll = item
+		}
+	}
+}
+
+// cleanPath
+// @Description: 规范化请求路径 合并连续的 / 并去掉末尾的 / 与注册路由时的规则一致
+// @PS: 绝大多数请求路径本身就是规范的 此时直接返回 不产生内存分配
+// @param p
+// @return string
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if !strings.Contains(p, "//") && (len(p) == 1 || p[len(p)-1] != '/') {
+		return p
+	}
+	var buf strings.Builder
+	for _, item := range strings.Split(p, "/") {
+		if item != "" {
+			buf.WriteByte('/')
+			buf.WriteString(item)
+		}
+	}
+	if buf.Len() == 0 {
+		return "/"
+	}
+	return buf.String()
+}
+
 // addRoute
 // @Description: 添加路由
+// @PS: 路由冲突(通配符名称冲突、通配符不在末尾、重复注册)时 panic
 // @receiver r
 // @param method
 // @param pattern
-// @param handler
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
-	parts := parsePattern(pattern)
+// @param handlers	完整的处理链
+func (r *router) addRoute(method string, pattern string, handlers []HandlerFunc) {
+	checkPattern(pattern)
+	path := "/" + strings.Join(parsePattern(pattern), "/")
 
 	key := method + "-" + pattern
+	if _, ok := r.handlers[key]; ok {
+		panic(fmt.Sprintf("gee: handlers are already registered for %s %s", method, pattern))
+	}
 	_, ok := r.roots[method]
 	if !ok {
 		r.roots[method] = &node{}
 	}
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	if count := strings.Count(path, "/:") + strings.Count(path, "/*"); count > r.maxParams {
+		r.maxParams = count
+	}
+	n := r.roots[method].insert(path, pattern)
+	n.key = key
+	r.handlers[key] = handlers
 }
 
-// getRoute
-// @Description: 获取路由
+// findRoute
+// @Description: 查找路由 匹配到的参数追加到 params 中
 // @receiver r
 // @param method
 // @param path
+// @param params	为 nil 时不收集参数
 // @return *node
-// @return map[string]string
-func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	searchParts := parsePattern(path)
-	params := make(map[string]string)
+func (r *router) findRoute(method string, path string, params *Params) *node {
 	root, ok := r.roots[method]
-
 	if !ok {
-		return nil, nil
+		return nil
 	}
+	return root.search(cleanPath(path), params)
+}
 
-	n := root.search(searchParts, 0)
-
-	if n != nil {
-		parts := parsePattern(n.pattern)
-		for index, part := range parts {
-			if part[0] == ':' {
-				params[part[1:]] = searchParts[index]
-			}
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchParts[index:], "/")
-				break
-			}
-		}
+// getRoute
+// @Description: 获取路由
+// @receiver r
+// @param method
+// @param path
+// @return *node
+// @return Params
+func (r *router) getRoute(method string, path string) (*node, Params) {
+	var params Params
+	if n := r.findRoute(method, path, &params); n != nil {
 		return n, params
 	}
 	return nil, nil
 }
 
+// headResponseWriter
+// @Description: HEAD 请求回退到 GET 处理器时使用 只保留状态码和响应头 丢弃响应体
+type headResponseWriter struct {
+	ResponseWriter
+}
+
+func (w *headResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	return len(data), nil
+}
+
+func (w *headResponseWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	return len(s), nil
+}
+
 // handle
 // @Description: 路由转发器
 // @receiver r
 // @param c
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
+	method := c.Method
+	// 复用 Context 上的参数切片 避免每次请求都分配内存
+	c.Params = c.Params[:0]
+	n := r.findRoute(method, c.Path, &c.Params)
+	// HEAD 路由不存在时 回退到 GET 路由 并丢弃响应体
+	if n == nil && method == http.MethodHead {
+		c.Params = c.Params[:0]
+		if n = r.findRoute(http.MethodGet, c.Path, &c.Params); n != nil {
+			method = http.MethodGet
+			c.Writer = &headResponseWriter{c.Writer}
+		}
+	}
 
 	if n != nil {
-		key := c.Method + "-" + n.pattern
-		c.Params = params
-		// 将路由的处理 Handler 放在最后处理
-		c.handlers = append(c.handlers, r.handlers[key])
-	} else {
-		// 路由不存在也要走中间件
-		c.handlers = append(c.handlers, func(c *Context) {
-			c.String(http.StatusNotFound, "404 NOT FOUND: %s \n", c.Path)
-		})
+		// 处理链在注册路由时已经生成
+		c.handlers = r.handlers[n.key]
+		c.Next()
+		return
+	}
+
+	engine := c.engine
+	// 自动响应 OPTIONS 请求 Allow 中列出该路径支持的全部请求方法
+	if method == http.MethodOptions && engine.HandleOPTIONS {
+		if allow := r.allowed(c.Path, method, true); allow != "" {
+			c.handlers = engine.matchGroup(c.Path).combineHandlers(func(c *Context) {
+				c.SetHeader("Allow", allow)
+				c.Status(http.StatusNoContent)
+			})
+			c.Next()
+			return
+		}
+	}
+	// 路径在其他请求方法下存在时 返回 405
+	if engine.HandleMethodNotAllowed {
+		if allow := r.allowed(c.Path, method, engine.HandleOPTIONS); allow != "" {
+			c.SetHeader("Allow", allow)
+			c.handlers = engine.noMethodHandlers(c.Path)
+			c.Next()
+			return
+		}
 	}
+	// 路由不存在也要走所属分组的中间件
+	c.handlers = engine.noRouteHandlers(c.Path)
 	c.Next()
 }
+
+// notFound 默认的 404 处理器
+func notFound(c *Context) {
+	c.String(http.StatusNotFound, "404 NOT FOUND: %s \n", c.Path)
+}
+
+// methodNotAllowed 默认的 405 处理器
+func methodNotAllowed(c *Context) {
+	c.String(http.StatusMethodNotAllowed, "405 METHOD NOT ALLOWED: %s \n", c.Path)
+}
+
+// allowed
+// @Description: 查找路径在其他请求方法下注册的路由 拼接为 Allow 头
+// @receiver r
+// @param path	请求路径 为 * 时返回所有已注册的请求方法
+// @param reqMethod	当前请求方法 不参与查找
+// @param withOptions	是否将自动响应的 OPTIONS 也列入 Allow
+// @return string
+func (r *router) allowed(path string, reqMethod string, withOptions bool) string {
+	methods := make(map[string]bool)
+	for method := range r.roots {
+		if method == reqMethod {
+			continue
+		}
+		if path == "*" {
+			methods[method] = true
+		} else if r.findRoute(method, path, nil) != nil {
+			methods[method] = true
+		}
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	// 存在 GET 路由时 HEAD 会自动回退到 GET
+	if methods[http.MethodGet] {
+		methods[http.MethodHead] = true
+	}
+	if withOptions {
+		methods[http.MethodOptions] = true
+	}
+
+	allow := make([]string, 0, len(methods))
+	for method := range methods {
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+	return strings.Join(allow, ", ")
+}
@@ -0,0 +1,459 @@
+package gee
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+/*
+与原先按 / 切分的前缀树对比 路由表为 GitHub API (207 条路由)
+
+$ go test -run none -bench GithubAll -benchmem
+BenchmarkGithubAll/trie         	    3085	    415912 ns/op	  147792 B/op	    2048 allocs/op
+BenchmarkGithubAll/radix        	   35955	     35269 ns/op	       0 B/op	       0 allocs/op
+*/
+
+// legacyNode 原先按 / 切分路由片段的前缀树 仅用于基准测试对比
+type legacyNode struct {
+	pattern  string        // 待匹配的路由 例如：/p/:lang
+	part     string        // 路由中的一部分 例如：:lang
+	children []*legacyNode // 子节点 例如：[doc, tutorial, intro]
+	isWild   bool          // 是否精准匹配, part 含有 : 或 * 时为 true
+}
+
+// matchChild
+// @Description: 与 part 完全相同的子节点，用于插入
+// @PS: 插入时不能复用通配符节点 否则 /a/*x 之后注册的 /a/b/c 会被挂到 *x 下
+// @receiver n
+// @param part
+// @return *legacyNode
+func (n *legacyNode) matchChild(part string) *legacyNode {
+	for _, child := range n.children {
+		if child.part == part {
+			return child
+		}
+	}
+	return nil
+}
+
+// matchChildren
+// @Description: 返回所有匹配成功的节点 用于查找
+// @PS: 按 静态节点 > :param > *catchall 的优先级排序 与路由注册顺序无关
+// @receiver n
+// @param part
+// @return []*legacyNode
+func (n *legacyNode) matchChildren(part string) []*legacyNode {
+	nodes := make([]*legacyNode, 0, 3)
+	var param, catchAll *legacyNode
+	for _, child := range n.children {
+		switch {
+		case !child.isWild:
+			if child.part == part {
+				nodes = append(nodes, child)
+			}
+		case child.part[0] == ':':
+			param = child
+		default:
+			catchAll = child
+		}
+	}
+	if param != nil {
+		nodes = append(nodes, param)
+	}
+	if catchAll != nil {
+		nodes = append(nodes, catchAll)
+	}
+	return nodes
+}
+
+// insert
+// @Description:
+// @receiver n
+// @param pattern	待匹配的模式
+// @param parts
+// @param height
+func (n *legacyNode) insert(pattern string, parts []string, height int) {
+	// 若深度遍历到了路由的深度 则表示遍历结束
+	if len(parts) == height {
+		// 节点上已经注册过路由 例如 /hello 与 /hello/ 解析后是同一个节点
+		if n.pattern != "" {
+			panic(fmt.Sprintf("gee: path '%s' conflicts with existing route '%s'", pattern, n.pattern))
+		}
+		n.pattern = pattern
+		return
+	}
+	// 获取当前深度的路由的 part 然后去当前节点的子节点中去寻找这个 part
+	// 找得到就说明 已经在子节点中 -> 遍历下一层
+	// 找不到就新增该节点
+	part := parts[height]
+	child := n.matchChild(part) // 找不到这个路由
+	if child == nil {
+		// 若 part 以 : 或 * 开头 则是模糊匹配
+		isWild := part[0] == ':' || part[0] == '*'
+		if isWild {
+			// 同一层的同类通配符只能有一个 名称不同即冲突 例如 /hello/:name 与 /hello/:id
+			for _, sibling := range n.children {
+				if sibling.isWild && sibling.part[0] == part[0] {
+					panic(fmt.Sprintf("gee: wildcard '%s' in new path '%s' conflicts with existing wildcard '%s'",
+						part, pattern, sibling.part))
+				}
+			}
+		}
+		child = &legacyNode{part: part, isWild: isWild}
+		// 将当前路由添加到 node 的子节点中
+		n.children = append(n.children, child)
+	}
+	// 递归 下一层
+	child.insert(pattern, parts, height+1)
+}
+
+// search
+// @Description:查找符合路由规则的节点
+// @receiver n
+// @param parts
+// @param height
+// @return *legacyNode
+func (n *legacyNode) search(parts []string, height int) *legacyNode {
+	// 如果遍历到了最底层 或者 当前节点的 part 是模糊匹配则进入到了最后一次
+	if len(parts) == height || strings.HasPrefix(n.part, "*") {
+		// 如果其没有后续路由 则表明匹配失败
+		if n.pattern == "" {
+			return nil
+		}
+		// 返回模糊匹配节点
+		return n
+	}
+	// 遍历 part
+	part := parts[height]
+	// 查找所有符合条件的子节点
+	children := n.matchChildren(part)
+	// 遍历子节点 子节点匹配失败时回溯 尝试下一个优先级更低的节点
+	for _, child := range children {
+		// 查找下一个 节点
+		result := child.search(parts, height+1)
+		if result != nil {
+			return result
+		}
+	}
+	// 查找失败
+	return nil
+}
+
+// legacyRouter 原先的路由查找实现 仅用于基准测试对比
+type legacyRouter struct {
+	roots map[string]*legacyNode
+}
+
+func (r *legacyRouter) addRoute(method string, pattern string) {
+	if _, ok := r.roots[method]; !ok {
+		r.roots[method] = &legacyNode{}
+	}
+	r.roots[method].insert(pattern, parsePattern(pattern), 0)
+}
+
+func (r *legacyRouter) getRoute(method string, path string) (*legacyNode, map[string]string) {
+	searchParts := parsePattern(path)
+	params := make(map[string]string)
+	root, ok := r.roots[method]
+	if !ok {
+		return nil, nil
+	}
+	n := root.search(searchParts, 0)
+	if n == nil {
+		return nil, nil
+	}
+	parts := parsePattern(n.pattern)
+	for index, part := range parts {
+		if part[0] == ':' {
+			params[part[1:]] = searchParts[index]
+		}
+		if part[0] == '*' && len(part) > 1 {
+			params[part[1:]] = strings.Join(searchParts[index:], "/")
+			break
+		}
+	}
+	return n, params
+}
+
+type benchRoute struct {
+	method string
+	path   string
+}
+
+// githubAPI GitHub API 的路由表
+var githubAPI = []benchRoute{
+	{"GET", "/authorizations"},
+	{"GET", "/authorizations/:id"},
+	{"POST", "/authorizations"},
+	{"DELETE", "/authorizations/:id"},
+	{"GET", "/applications/:client_id/tokens/:access_token"},
+	{"DELETE", "/applications/:client_id/tokens"},
+	{"DELETE", "/applications/:client_id/tokens/:access_token"},
+	{"GET", "/events"},
+	{"GET", "/repos/:owner/:repo/events"},
+	{"GET", "/networks/:owner/:repo/events"},
+	{"GET", "/orgs/:org/events"},
+	{"GET", "/users/:user/received_events"},
+	{"GET", "/users/:user/received_events/public"},
+	{"GET", "/users/:user/events"},
+	{"GET", "/users/:user/events/public"},
+	{"GET", "/users/:user/events/orgs/:org"},
+	{"GET", "/feeds"},
+	{"GET", "/notifications"},
+	{"GET", "/repos/:owner/:repo/notifications"},
+	{"PUT", "/notifications"},
+	{"PUT", "/repos/:owner/:repo/notifications"},
+	{"GET", "/notifications/threads/:id"},
+	{"GET", "/notifications/threads/:id/subscription"},
+	{"PUT", "/notifications/threads/:id/subscription"},
+	{"DELETE", "/notifications/threads/:id/subscription"},
+	{"GET", "/repos/:owner/:repo/stargazers"},
+	{"GET", "/users/:user/starred"},
+	{"GET", "/user/starred"},
+	{"GET", "/user/starred/:owner/:repo"},
+	{"PUT", "/user/starred/:owner/:repo"},
+	{"DELETE", "/user/starred/:owner/:repo"},
+	{"GET", "/repos/:owner/:repo/subscribers"},
+	{"GET", "/users/:user/subscriptions"},
+	{"GET", "/user/subscriptions"},
+	{"GET", "/repos/:owner/:repo/subscription"},
+	{"PUT", "/repos/:owner/:repo/subscription"},
+	{"DELETE", "/repos/:owner/:repo/subscription"},
+	{"GET", "/user/subscriptions/:owner/:repo"},
+	{"PUT", "/user/subscriptions/:owner/:repo"},
+	{"DELETE", "/user/subscriptions/:owner/:repo"},
+	{"GET", "/users/:user/gists"},
+	{"GET", "/gists"},
+	{"GET", "/gists/:id"},
+	{"POST", "/gists"},
+	{"PUT", "/gists/:id/star"},
+	{"DELETE", "/gists/:id/star"},
+	{"GET", "/gists/:id/star"},
+	{"POST", "/gists/:id/forks"},
+	{"DELETE", "/gists/:id"},
+	{"GET", "/repos/:owner/:repo/git/blobs/:sha"},
+	{"POST", "/repos/:owner/:repo/git/blobs"},
+	{"GET", "/repos/:owner/:repo/git/commits/:sha"},
+	{"POST", "/repos/:owner/:repo/git/commits"},
+	{"GET", "/repos/:owner/:repo/git/refs/*ref"},
+	{"GET", "/repos/:owner/:repo/git/refs"},
+	{"POST", "/repos/:owner/:repo/git/refs"},
+	{"DELETE", "/repos/:owner/:repo/git/refs/*ref"},
+	{"GET", "/repos/:owner/:repo/git/tags/:sha"},
+	{"POST", "/repos/:owner/:repo/git/tags"},
+	{"GET", "/repos/:owner/:repo/git/trees/:sha"},
+	{"POST", "/repos/:owner/:repo/git/trees"},
+	{"GET", "/issues"},
+	{"GET", "/user/issues"},
+	{"GET", "/orgs/:org/issues"},
+	{"GET", "/repos/:owner/:repo/issues"},
+	{"GET", "/repos/:owner/:repo/issues/:number"},
+	{"POST", "/repos/:owner/:repo/issues"},
+	{"GET", "/repos/:owner/:repo/assignees"},
+	{"GET", "/repos/:owner/:repo/assignees/:assignee"},
+	{"GET", "/repos/:owner/:repo/issues/:number/comments"},
+	{"POST", "/repos/:owner/:repo/issues/:number/comments"},
+	{"GET", "/repos/:owner/:repo/issues/:number/events"},
+	{"GET", "/repos/:owner/:repo/labels"},
+	{"GET", "/repos/:owner/:repo/labels/:name"},
+	{"POST", "/repos/:owner/:repo/labels"},
+	{"DELETE", "/repos/:owner/:repo/labels/:name"},
+	{"GET", "/repos/:owner/:repo/issues/:number/labels"},
+	{"POST", "/repos/:owner/:repo/issues/:number/labels"},
+	{"DELETE", "/repos/:owner/:repo/issues/:number/labels/:name"},
+	{"PUT", "/repos/:owner/:repo/issues/:number/labels"},
+	{"DELETE", "/repos/:owner/:repo/issues/:number/labels"},
+	{"GET", "/repos/:owner/:repo/milestones/:number/labels"},
+	{"GET", "/repos/:owner/:repo/milestones"},
+	{"GET", "/repos/:owner/:repo/milestones/:number"},
+	{"POST", "/repos/:owner/:repo/milestones"},
+	{"DELETE", "/repos/:owner/:repo/milestones/:number"},
+	{"GET", "/emojis"},
+	{"GET", "/gitignore/templates"},
+	{"GET", "/gitignore/templates/:name"},
+	{"POST", "/markdown"},
+	{"POST", "/markdown/raw"},
+	{"GET", "/meta"},
+	{"GET", "/rate_limit"},
+	{"GET", "/users/:user/orgs"},
+	{"GET", "/user/orgs"},
+	{"GET", "/orgs/:org"},
+	{"GET", "/orgs/:org/members"},
+	{"GET", "/orgs/:org/members/:user"},
+	{"DELETE", "/orgs/:org/members/:user"},
+	{"GET", "/orgs/:org/public_members"},
+	{"GET", "/orgs/:org/public_members/:user"},
+	{"PUT", "/orgs/:org/public_members/:user"},
+	{"DELETE", "/orgs/:org/public_members/:user"},
+	{"GET", "/orgs/:org/teams"},
+	{"GET", "/teams/:id"},
+	{"POST", "/orgs/:org/teams"},
+	{"DELETE", "/teams/:id"},
+	{"GET", "/teams/:id/members"},
+	{"GET", "/teams/:id/members/:user"},
+	{"PUT", "/teams/:id/members/:user"},
+	{"DELETE", "/teams/:id/members/:user"},
+	{"GET", "/teams/:id/repos"},
+	{"GET", "/teams/:id/repos/:owner/:repo"},
+	{"PUT", "/teams/:id/repos/:owner/:repo"},
+	{"DELETE", "/teams/:id/repos/:owner/:repo"},
+	{"GET", "/user/teams"},
+	{"GET", "/repos/:owner/:repo/pulls"},
+	{"GET", "/repos/:owner/:repo/pulls/:number"},
+	{"POST", "/repos/:owner/:repo/pulls"},
+	{"GET", "/repos/:owner/:repo/pulls/:number/commits"},
+	{"GET", "/repos/:owner/:repo/pulls/:number/files"},
+	{"GET", "/repos/:owner/:repo/pulls/:number/merge"},
+	{"PUT", "/repos/:owner/:repo/pulls/:number/merge"},
+	{"GET", "/repos/:owner/:repo/pulls/:number/comments"},
+	{"PUT", "/repos/:owner/:repo/pulls/:number/comments"},
+	{"GET", "/user/repos"},
+	{"GET", "/users/:user/repos"},
+	{"GET", "/orgs/:org/repos"},
+	{"GET", "/repositories"},
+	{"POST", "/user/repos"},
+	{"POST", "/orgs/:org/repos"},
+	{"GET", "/repos/:owner/:repo"},
+	{"DELETE", "/repos/:owner/:repo"},
+	{"GET", "/repos/:owner/:repo/contributors"},
+	{"GET", "/repos/:owner/:repo/languages"},
+	{"GET", "/repos/:owner/:repo/teams"},
+	{"GET", "/repos/:owner/:repo/tags"},
+	{"GET", "/repos/:owner/:repo/branches"},
+	{"GET", "/repos/:owner/:repo/branches/:branch"},
+	{"GET", "/repos/:owner/:repo/collaborators"},
+	{"GET", "/repos/:owner/:repo/collaborators/:user"},
+	{"PUT", "/repos/:owner/:repo/collaborators/:user"},
+	{"DELETE", "/repos/:owner/:repo/collaborators/:user"},
+	{"GET", "/repos/:owner/:repo/comments"},
+	{"GET", "/repos/:owner/:repo/commits/:sha/comments"},
+	{"POST", "/repos/:owner/:repo/commits/:sha/comments"},
+	{"GET", "/repos/:owner/:repo/comments/:id"},
+	{"DELETE", "/repos/:owner/:repo/comments/:id"},
+	{"GET", "/repos/:owner/:repo/commits"},
+	{"GET", "/repos/:owner/:repo/commits/:sha"},
+	{"GET", "/repos/:owner/:repo/readme"},
+	{"GET", "/repos/:owner/:repo/contents/*path"},
+	{"DELETE", "/repos/:owner/:repo/contents/*path"},
+	{"GET", "/repos/:owner/:repo/keys"},
+	{"GET", "/repos/:owner/:repo/keys/:id"},
+	{"POST", "/repos/:owner/:repo/keys"},
+	{"DELETE", "/repos/:owner/:repo/keys/:id"},
+	{"GET", "/repos/:owner/:repo/downloads"},
+	{"GET", "/repos/:owner/:repo/downloads/:id"},
+	{"DELETE", "/repos/:owner/:repo/downloads/:id"},
+	{"GET", "/repos/:owner/:repo/forks"},
+	{"POST", "/repos/:owner/:repo/forks"},
+	{"GET", "/repos/:owner/:repo/hooks"},
+	{"GET", "/repos/:owner/:repo/hooks/:id"},
+	{"POST", "/repos/:owner/:repo/hooks"},
+	{"POST", "/repos/:owner/:repo/hooks/:id/tests"},
+	{"DELETE", "/repos/:owner/:repo/hooks/:id"},
+	{"POST", "/repos/:owner/:repo/merges"},
+	{"GET", "/repos/:owner/:repo/releases"},
+	{"GET", "/repos/:owner/:repo/releases/:id"},
+	{"POST", "/repos/:owner/:repo/releases"},
+	{"DELETE", "/repos/:owner/:repo/releases/:id"},
+	{"GET", "/repos/:owner/:repo/releases/:id/assets"},
+	{"GET", "/repos/:owner/:repo/stats/contributors"},
+	{"GET", "/repos/:owner/:repo/stats/commit_activity"},
+	{"GET", "/repos/:owner/:repo/stats/code_frequency"},
+	{"GET", "/repos/:owner/:repo/stats/participation"},
+	{"GET", "/repos/:owner/:repo/stats/punch_card"},
+	{"GET", "/repos/:owner/:repo/statuses/:ref"},
+	{"POST", "/repos/:owner/:repo/statuses/:ref"},
+	{"GET", "/search/repositories"},
+	{"GET", "/search/code"},
+	{"GET", "/search/issues"},
+	{"GET", "/search/users"},
+	{"GET", "/legacy/issues/search/:owner/:repository/:state/:keyword"},
+	{"GET", "/legacy/repos/search/:keyword"},
+	{"GET", "/legacy/user/search/:keyword"},
+	{"GET", "/legacy/user/email/:email"},
+	{"GET", "/users/:user"},
+	{"GET", "/user"},
+	{"GET", "/users"},
+	{"GET", "/user/emails"},
+	{"POST", "/user/emails"},
+	{"DELETE", "/user/emails"},
+	{"GET", "/users/:user/followers"},
+	{"GET", "/user/followers"},
+	{"GET", "/users/:user/following"},
+	{"GET", "/user/following"},
+	{"GET", "/user/following/:user"},
+	{"GET", "/users/:user/following/:target_user"},
+	{"PUT", "/user/following/:user"},
+	{"DELETE", "/user/following/:user"},
+	{"GET", "/users/:user/keys"},
+	{"GET", "/user/keys"},
+	{"GET", "/user/keys/:id"},
+	{"POST", "/user/keys"},
+	{"DELETE", "/user/keys/:id"},
+}
+
+// requestPath 将路由中的通配符替换为具体的值 得到请求路径
+func requestPath(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if part != "" && (part[0] == ':' || part[0] == '*') {
+			parts[i] = "gee" + part[1:]
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func TestGithubRoutes(t *testing.T) {
+	r := newRouter()
+	for _, route := range githubAPI {
+		r.addRoute(route.method, route.path, nil)
+	}
+	for _, route := range githubAPI {
+		n, ps := r.getRoute(route.method, requestPath(route.path))
+		if n == nil || n.pattern != route.path {
+			t.Fatalf("%s %s: matched %v", route.method, route.path, n)
+		}
+		for _, p := range ps {
+			if p.Value != "gee"+p.Key {
+				t.Fatalf("%s %s: unexpected param %s=%s", route.method, route.path, p.Key, p.Value)
+			}
+		}
+	}
+}
+
+func BenchmarkGithubAll(b *testing.B) {
+	requests := make([]benchRoute, len(githubAPI))
+	for i, route := range githubAPI {
+		requests[i] = benchRoute{route.method, requestPath(route.path)}
+	}
+
+	b.Run("trie", func(b *testing.B) {
+		r := &legacyRouter{roots: make(map[string]*legacyNode)}
+		for _, route := range githubAPI {
+			r.addRoute(route.method, route.path)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, req := range requests {
+				r.getRoute(req.method, req.path)
+			}
+		}
+	})
+
+	b.Run("radix", func(b *testing.B) {
+		r := newRouter()
+		for _, route := range githubAPI {
+			r.addRoute(route.method, route.path, nil)
+		}
+		params := make(Params, 0, 8)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, req := range requests {
+				params = params[:0]
+				r.findRoute(req.method, req.path, &params)
+			}
+		}
+	})
+}
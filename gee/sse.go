@@ -0,0 +1,70 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const sseContentType = "text/event-stream"
+
+// SSEventRender
+// @Description: 一条 Server-Sent Events 消息
+// @PS: Data 为 string、[]byte 时原样输出 其余类型编码为 JSON 多行数据会拆分为多个 data 字段
+type SSEventRender struct {
+	Event string
+	ID    string
+	Retry uint // 断开后浏览器重连的间隔 单位为毫秒 为 0 时不发送
+	Data  interface{}
+}
+
+// sseFieldReplacer event、id 中不允许出现换行
+var sseFieldReplacer = strings.NewReplacer("\n", "\\n", "\r", "\\r")
+
+// Render 按 text/event-stream 格式写入消息 以空行结尾
+func (e SSEventRender) Render(w http.ResponseWriter) error {
+	buf := new(bytes.Buffer)
+	if e.ID != "" {
+		buf.WriteString("id: " + sseFieldReplacer.Replace(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + sseFieldReplacer.Replace(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatUint(uint64(e.Retry), 10) + "\n")
+	}
+
+	var data string
+	switch v := e.Data.(type) {
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = string(encoded)
+	}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteContentType 设置 SSE 所需的响应头
+func (e SSEventRender) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	writeContentType(w, sseContentType)
+	if header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", "no-cache")
+	}
+	// 关闭 nginx 等反向代理的缓冲 保证消息及时到达浏览器
+	header.Set("X-Accel-Buffering", "no")
+}
@@ -0,0 +1,101 @@
+package gee
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEvent(t *testing.T) {
+	r := New()
+	r.GET("/events", func(c *Context) {
+		c.SSEvent("log", "line 1\nline 2")
+		c.Render(-1, SSEventRender{ID: "2", Retry: 3000, Data: H{"cpu": 1}})
+		c.SSEvent("", []byte("bye"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	want := "event: log\ndata: line 1\ndata: line 2\n\n" +
+		"id: 2\nretry: 3000\ndata: {\"cpu\":1}\n\n" +
+		"data: bye\n\n"
+	if w.Body.String() != want {
+		t.Fatalf("body = %q, want %q", w.Body.String(), want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != sseContentType {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Fatalf("Cache-Control = %q", cc)
+	}
+	if !w.Flushed {
+		t.Fatal("events were not flushed")
+	}
+}
+
+func TestStream(t *testing.T) {
+	r := New()
+	r.GET("/count", func(c *Context) {
+		i := 0
+		c.Stream(func(w io.Writer) bool {
+			i++
+			fmt.Fprintf(w, "%d\n", i)
+			return i < 3
+		})
+	})
+	stopped := make(chan bool, 1)
+	r.GET("/forever", func(c *Context) {
+		stopped <- c.Stream(func(w io.Writer) bool {
+			c.SSEvent("tick", time.Now().UnixNano())
+			time.Sleep(time.Millisecond)
+			return true
+		})
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "1\n2\n3\n" {
+		t.Fatalf("body = %q", body)
+	}
+
+	// 读到两条消息后断开连接 Stream 应当返回 true
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/forever", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(resp.Body)
+	for events := 0; events < 2; {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "event: tick") {
+			events++
+		}
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case gone := <-stopped:
+		if !gone {
+			t.Fatal("Stream() = false, want true after client disconnect")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stream did not stop after client disconnect")
+	}
+}
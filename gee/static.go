@@ -0,0 +1,345 @@
+package gee
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexFile 目录的默认文件
+const indexFile = "index.html"
+
+// StaticOptions
+// @Description: 静态文件目录的选项
+type StaticOptions struct {
+	// ListDirectory 目录下没有 index.html 时列出目录内容 默认返回 404
+	ListDirectory bool
+	// SPA 单页应用模式 没有扩展名的路径找不到文件时返回根目录的 index.html 由前端路由处理
+	SPA bool
+	// Precompressed 存在 .br 或 .gz 文件且 Accept-Encoding 允许时 返回预压缩的文件
+	Precompressed bool
+	// CacheControl 该目录下文件的 Cache-Control 为空时不设置 客户端依靠 ETag 重新验证
+	CacheControl string
+	// ImmutableFingerprinted 文件名带有内容指纹时(见 isFingerprinted) 缓存一年并标记为 immutable
+	ImmutableFingerprinted bool
+}
+
+// Static
+// @Description: 静态文件路由 将 root 目录挂载到 relativePath 下
+// @receiver group
+// @param relativePath
+// @param root
+// @param opts
+func (group *RouterGroup) Static(relativePath string, root string, opts ...StaticOptions) {
+	group.StaticFS(relativePath, os.DirFS(root), opts...)
+}
+
+// StaticFS
+// @Description: 与 Static 相同 但是从 fs.FS 中读取文件 可以直接使用 embed.FS
+// @PS: embed.FS 中的路径包含目录名 需要先使用 fs.Sub 取出子目录
+// @receiver group
+// @param relativePath
+// @param fsys
+// @param opts
+func (group *RouterGroup) StaticFS(relativePath string, fsys fs.FS, opts ...StaticOptions) {
+	if strings.ContainsAny(relativePath, ":*") {
+		panic("gee: URL parameters can not be used when serving a static folder")
+	}
+	var opt StaticOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	handler := createStaticHandler(http.FS(fsys), opt)
+	group.GET(path.Join(relativePath, "/*filepath"), handler)
+	// 目录本身 例如 /assets 和 /assets/
+	group.GET(relativePath, handler)
+}
+
+// StaticFile
+// @Description: 将单个文件注册为路由 例如 /favicon.ico
+// @receiver group
+// @param relativePath
+// @param filepath
+func (group *RouterGroup) StaticFile(relativePath string, filepath string) {
+	if strings.ContainsAny(relativePath, ":*") {
+		panic("gee: URL parameters can not be used when serving a static file")
+	}
+	group.GET(relativePath, func(c *Context) {
+		c.File(filepath)
+	})
+}
+
+// createStaticHandler
+// @Description: 静态资源处理器 打开的文件在响应结束后关闭
+// @param fsys
+// @param opt
+// @return HandlerFunc
+func createStaticHandler(fsys http.FileSystem, opt StaticOptions) HandlerFunc {
+	s := &staticServer{fsys: fsys, opt: opt}
+	return s.handle
+}
+
+// staticServer 一个静态文件目录
+type staticServer struct {
+	fsys  http.FileSystem
+	opt   StaticOptions
+	etags sync.Map // 文件路径 -> *staticETag
+}
+
+// staticETag 缓存的内容哈希 文件的修改时间或大小变化时重新计算
+type staticETag struct {
+	modtime time.Time
+	size    int64
+	etag    string
+}
+
+// precompressedEncodings Content-Encoding 对应的预压缩文件扩展名
+var precompressedEncodings = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+func (s *staticServer) handle(c *Context) {
+	name := path.Clean("/" + c.Param("filepath"))
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		if s.opt.SPA && errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "" {
+			s.serveFile(c, "/"+indexFile)
+			return
+		}
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	if !info.IsDir() {
+		s.serve(c, f, info, name)
+		return
+	}
+
+	// 目录需要以 / 结尾 否则 index.html 中的相对路径会出错
+	if !strings.HasSuffix(c.Req.URL.Path, "/") {
+		target := path.Base(c.Req.URL.Path) + "/"
+		if c.Req.URL.RawQuery != "" {
+			target += "?" + c.Req.URL.RawQuery
+		}
+		c.SetHeader("Location", target)
+		c.Status(http.StatusMovedPermanently)
+		return
+	}
+	indexPath := path.Join(name, indexFile)
+	if index, err := s.fsys.Open(indexPath); err == nil {
+		defer index.Close()
+		if info, err := index.Stat(); err == nil && !info.IsDir() {
+			s.serve(c, index, info, indexPath)
+			return
+		}
+	}
+	if s.opt.ListDirectory {
+		c.listDirectory(f)
+		return
+	}
+	c.fileError(fs.ErrNotExist)
+}
+
+// serveFile 打开并写入 name 对应的文件
+func (s *staticServer) serveFile(c *Context, name string) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		c.fileError(fs.ErrNotExist)
+		return
+	}
+	s.serve(c, f, info, name)
+}
+
+// serve
+// @Description: 写入文件 按选项使用预压缩文件 设置基于内容哈希的 ETag 以及 Cache-Control
+// @receiver s
+// @param c
+// @param f
+// @param info
+// @param name
+func (s *staticServer) serve(c *Context, f http.File, info os.FileInfo, name string) {
+	header := c.Writer.Header()
+	var ctype, encoding string
+	if s.opt.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		if e, cf, cinfo := s.openPrecompressed(c, name); cf != nil {
+			defer cf.Close()
+			// Content-Type 由原文件的扩展名决定 避免根据压缩后的内容推断
+			ctype = mime.TypeByExtension(path.Ext(name))
+			if ctype == "" {
+				ctype = "application/octet-stream"
+			}
+			encoding = e
+			name, f, info = name+precompressedEncodings[encoding], cf, cinfo
+		}
+	}
+
+	etag, err := s.etag(f, info, name)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	// 确定可以返回文件后再设置编码 避免错误信息带上 Content-Encoding
+	if encoding != "" {
+		header.Set("Content-Type", ctype)
+		header.Set("Content-Encoding", encoding)
+	}
+	header.Set("ETag", etag)
+	if s.opt.ImmutableFingerprinted && isFingerprinted(name) {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else if s.opt.CacheControl != "" {
+		header.Set("Cache-Control", s.opt.CacheControl)
+	}
+	c.serveFile(f, name)
+}
+
+// openPrecompressed
+// @Description: 打开客户端可以接受的预压缩文件 权重相同时优先使用 br
+// @receiver s
+// @param c
+// @param name
+// @return string	Content-Encoding 没有可用的预压缩文件时返回 nil
+// @return http.File
+// @return os.FileInfo
+func (s *staticServer) openPrecompressed(c *Context, name string) (string, http.File, os.FileInfo) {
+	accept := c.Req.Header.Get("Accept-Encoding")
+	encodings := []string{"br", "gzip"}
+	if encodingQuality(accept, "gzip") > encodingQuality(accept, "br") {
+		encodings[0], encodings[1] = encodings[1], encodings[0]
+	}
+	for _, encoding := range encodings {
+		if encodingQuality(accept, encoding) <= 0 {
+			continue
+		}
+		f, err := s.fsys.Open(name + precompressedEncodings[encoding])
+		if err != nil {
+			continue
+		}
+		if info, err := f.Stat(); err == nil && !info.IsDir() {
+			return encoding, f, info
+		}
+		f.Close()
+	}
+	return "", nil, nil
+}
+
+// encodingQuality Accept-Encoding 中 encoding 的 q 值 没有出现时使用 * 的 q 值
+func encodingQuality(accept string, encoding string) float64 {
+	quality, wildcard := -1.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		name := strings.TrimSpace(params[0])
+		if name != encoding && name != "*" {
+			continue
+		}
+		q := acceptQuality(params[1:])
+		if name == "*" {
+			wildcard = q
+		} else {
+			quality = q
+		}
+	}
+	if quality < 0 {
+		return wildcard
+	}
+	return quality
+}
+
+// etag
+// @Description: 使用 SHA-256 计算文件内容的强 ETag 结果按路径缓存
+// @receiver s
+// @param f	计算后会 Seek 回开头
+// @param info
+// @param name
+// @return string
+// @return error
+func (s *staticServer) etag(f http.File, info os.FileInfo, name string) (string, error) {
+	if cached, ok := s.etags.Load(name); ok {
+		entry := cached.(*staticETag)
+		if entry.size == info.Size() && entry.modtime.Equal(info.ModTime()) {
+			return entry.etag, nil
+		}
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(name, &staticETag{modtime: info.ModTime(), size: info.Size(), etag: etag})
+	return etag, nil
+}
+
+// isFingerprinted
+// @Description: 文件名是否带有内容指纹 即以 . 或 - 分隔的 8 位以上的十六进制片段 例如 app.3f2a9c1b.js、logo-5d41402abc4b2a76.png
+// @PS: 片段中必须包含 a-f 的字母 纯数字的片段多半是日期或版本号 例如 report-20240101.pdf 同名文件更新后不能被缓存一年
+// @param name
+// @return bool
+func isFingerprinted(name string) bool {
+	base := path.Base(name)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	parts := strings.FieldsFunc(base, func(r rune) bool { return r == '.' || r == '-' })
+	// 第一段是文件名本身
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if len(part) >= 8 && strings.Trim(part, "0123456789abcdefABCDEF") == "" &&
+			strings.ContainsAny(part, "abcdefABCDEF") {
+			return true
+		}
+	}
+	return false
+}
+
+// listDirectory 以 HTML 列出目录下的文件 子目录以 / 结尾
+func (c *Context) listDirectory(dir http.File) {
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	var b strings.Builder
+	b.WriteString("<pre>\n")
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(name))
+	}
+	b.WriteString("</pre>\n")
+	c.SetHeader("Content-Type", htmlContentType)
+	c.Render(http.StatusOK, StringRender{Format: b.String()})
+}
@@ -0,0 +1,265 @@
+package gee
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS 记录打开但尚未关闭的文件数
+type countingFS struct {
+	fs.FS
+	open int
+}
+
+type countingFile struct {
+	fs.File
+	fsys *countingFS
+}
+
+func (f *countingFile) Close() error {
+	f.fsys.open--
+	return f.File.Close()
+}
+
+func (f *countingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+func (f *countingFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	return f.File.(fs.ReadDirFile).ReadDir(n)
+}
+
+func (fsys *countingFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fsys.open++
+	return &countingFile{File: f, fsys: fsys}, nil
+}
+
+func TestStaticFS(t *testing.T) {
+	files := &countingFS{FS: fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>home</h1>")},
+		"app.js":            {Data: []byte("console.log(1)")},
+		"docs/index.html":   {Data: []byte("docs")},
+		"images/logo.png":   {Data: []byte("png")},
+		"images/<icon>.svg": {Data: []byte("svg")},
+	}}
+
+	r := New()
+	r.StaticFS("/assets", files)
+	r.StaticFS("/public", files, StaticOptions{ListDirectory: true})
+	r.StaticFS("/app", files, StaticOptions{SPA: true})
+
+	tests := []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/assets/app.js", http.StatusOK, "console.log(1)", ""},
+		{"/assets/", http.StatusOK, "<h1>home</h1>", ""},
+		{"/assets", http.StatusMovedPermanently, "", "assets/"},
+		{"/assets/docs?v=1", http.StatusMovedPermanently, "", "docs/?v=1"},
+		{"/assets/docs/", http.StatusOK, "docs", ""},
+		{"/assets/images/", http.StatusNotFound, "", ""},
+		{"/assets/missing.js", http.StatusNotFound, "", ""},
+		{"/assets/../../etc/passwd", http.StatusNotFound, "", ""},
+		{"/public/images/", http.StatusOK,
+			"<pre>\n<a href=\"%3Cicon%3E.svg\">&lt;icon&gt;.svg</a>\n<a href=\"logo.png\">logo.png</a>\n</pre>\n", ""},
+		{"/app/users/1", http.StatusOK, "<h1>home</h1>", ""},
+		{"/app/app.js", http.StatusOK, "console.log(1)", ""},
+		{"/app/missing.js", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) || w.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s = %d %q %q, want %d %q %q", tt.path, w.Code, w.Body.String(), w.Header().Get("Location"),
+				tt.code, tt.body, tt.location)
+		}
+	}
+	if files.open != 0 {
+		t.Fatalf("%d files were not closed", files.open)
+	}
+}
+
+func TestStaticAndStaticFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte("body{}"), 0644)
+	os.WriteFile(filepath.Join(dir, "favicon.ico"), []byte("ico"), 0644)
+
+	r := New()
+	v1 := r.Group("/v1")
+	v1.Static("/static", dir)
+	r.StaticFile("/favicon.ico", filepath.Join(dir, "favicon.ico"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/static/style.css", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Fatalf("GET style.css = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	// 默认不列出目录
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/static/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("directory listing should be disabled by default, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/favicon.ico", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "3" {
+		t.Fatalf("HEAD favicon.ico = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for URL parameters in static path")
+		}
+	}()
+	r.Static("/files/:name", dir)
+}
+
+// brokenFS 打开 suffix 结尾的文件后读取总是失败
+type brokenFS struct {
+	fs.FS
+	suffix string
+}
+
+type brokenFile struct {
+	fs.File
+}
+
+func (f brokenFile) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func (f brokenFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+func (fsys brokenFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil || !strings.HasSuffix(name, fsys.suffix) {
+		return f, err
+	}
+	return brokenFile{File: f}, nil
+}
+
+func TestStaticPrecompressedAndCaching(t *testing.T) {
+	files := fstest.MapFS{
+		"app.js":             {Data: []byte("plain")},
+		"app.js.br":          {Data: []byte("brotli")},
+		"app.js.gz":          {Data: []byte("gzip")},
+		"style.css":          {Data: []byte("body{}")},
+		"main.3f2a9c1b.js":   {Data: []byte("hashed")},
+		"logo-5d41402abc.js": {Data: []byte("hashed")},
+	}
+	r := New()
+	r.StaticFS("/assets", files, StaticOptions{
+		Precompressed:          true,
+		CacheControl:           "public, max-age=60",
+		ImmutableFingerprinted: true,
+	})
+	r.StaticFS("/raw", files)
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		body           string
+		encoding       string
+	}{
+		{"none", "", "plain", ""},
+		{"gzip", "gzip, deflate", "gzip", "gzip"},
+		{"br preferred", "gzip, deflate, br", "brotli", "br"},
+		{"q values", "br;q=0.5, gzip", "gzip", "gzip"},
+		{"br refused", "br;q=0, gzip;q=0.1", "gzip", "gzip"},
+		{"wildcard", "*", "brotli", "br"},
+		{"identity", "identity", "plain", ""},
+	}
+	etags := map[string]bool{}
+	for _, tt := range tests {
+		w := get("/assets/app.js", map[string]string{"Accept-Encoding": tt.acceptEncoding})
+		if w.Body.String() != tt.body || w.Header().Get("Content-Encoding") != tt.encoding {
+			t.Errorf("%s: body %q encoding %q, want %q %q", tt.name, w.Body.String(), w.Header().Get("Content-Encoding"), tt.body, tt.encoding)
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") && !strings.HasPrefix(w.Header().Get("Content-Type"), "application/javascript") {
+			t.Errorf("%s: Content-Type = %q", tt.name, w.Header().Get("Content-Type"))
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" || w.Header().Get("Cache-Control") != "public, max-age=60" {
+			t.Errorf("%s: headers = %v", tt.name, w.Header())
+		}
+		etags[w.Header().Get("ETag")] = true
+	}
+	// 每种编码的内容不同 ETag 也不同
+	if len(etags) != 3 {
+		t.Fatalf("expect 3 distinct etags, got %v", etags)
+	}
+
+	w := get("/assets/style.css", nil)
+	etag := w.Header().Get("ETag")
+	if len(etag) != 34 || etag[0] != '"' {
+		t.Fatalf("ETag = %q", etag)
+	}
+	if w := get("/assets/style.css", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match = %d", w.Code)
+	}
+	// 内容相同的文件 ETag 相同
+	if get("/assets/main.3f2a9c1b.js", nil).Header().Get("ETag") != get("/assets/logo-5d41402abc.js", nil).Header().Get("ETag") {
+		t.Fatal("ETag should depend on content only")
+	}
+
+	for _, name := range []string{"main.3f2a9c1b.js", "logo-5d41402abc.js"} {
+		if cc := get("/assets/"+name, nil).Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+			t.Errorf("%s: Cache-Control = %q", name, cc)
+		}
+	}
+	// 读取预压缩文件失败时 错误信息不能带有 Content-Encoding
+	r.StaticFS("/broken", brokenFS{FS: files, suffix: ".br"}, StaticOptions{Precompressed: true})
+	w = get("/broken/app.js", map[string]string{"Accept-Encoding": "br"})
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Encoding") != "" ||
+		w.Header().Get("Content-Type") != jsonContentType {
+		t.Fatalf("broken precompressed file = %d %v", w.Code, w.Header())
+	}
+
+	w = get("/raw/app.js", map[string]string{"Accept-Encoding": "br"})
+	if w.Body.String() != "plain" || w.Header().Get("Cache-Control") != "" || w.Header().Get("Vary") != "" {
+		t.Fatalf("precompressed files should be opt-in: %q %v", w.Body.String(), w.Header())
+	}
+}
+
+func TestIsFingerprinted(t *testing.T) {
+	tests := map[string]bool{
+		"app.3f2a9c1b.js":           true,
+		"/js/chunk-0123456789ab.js": true,
+		"jquery-3.6.0.min.js":       false,
+		"favicon.ico":               false,
+		"deadbeef":                  false,
+		"material.css":              false,
+		"report-20240101.pdf":       false,
+		"v.12345678.js":             false,
+	}
+	for name, want := range tests {
+		if got := isFingerprinted(name); got != want {
+			t.Errorf("isFingerprinted(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -1,99 +1,233 @@
 package gee
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
+// nodeType 节点类型
+type nodeType uint8
+
+const (
+	static   nodeType = iota // 静态节点 例如：/hello/
+	param                    // 参数节点 例如：:name
+	catchAll                 // 通配节点 例如：*filepath
+)
+
+// node
+// @Description: 压缩前缀树(radix tree)的节点
+// @PS: 静态路径按公共前缀合并为一个节点 通配符节点只会出现在 / 之后 并且单独占据一个路由片段
 type node struct {
-	pattern  string  // 待匹配的路由 例如：/p/:lang
-	part     string  // 路由中的一部分 例如：:lang
-	children []*node // 子节点 例如：[doc, tutorial, intro]
-	isWild   bool    // 是否精准匹配, part 含有 : 或 * 时为 true
+	path      string   // 节点对应的路径片段 静态节点可以跨越多个 / 例如：/hello/ 参数节点为 :name
+	nType     nodeType // 节点类型
+	indices   string   // 静态子节点 path 的首字符 与 children 一一对应 用于快速定位子节点
+	children  []*node  // 静态子节点
+	paramNode *node    // :param 子节点 同一层最多一个
+	wildNode  *node    // *catchall 子节点 同一层最多一个
+	pattern   string   // 注册的完整路由 例如：/p/:lang 只有路由的终点节点不为空
+	key       string   // 路由在 router.handlers 中的 key
+}
+
+// Param
+// @Description: 路由参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路由参数列表 顺序与 pattern 中出现的顺序一致
+type Params []Param
+
+// Get
+// @Description: 获取路由参数
+// @receiver ps
+// @param name
+// @return string
+// @return bool	参数是否存在
+func (ps Params) Get(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName
+// @Description: 获取路由参数 不存在时返回空字符串
+// @receiver ps
+// @param name
+// @return string
+func (ps Params) ByName(name string) string {
+	value, _ := ps.Get(name)
+	return value
+}
+
+// longestCommonPrefix 两个字符串公共前缀的长度
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// wildcardIndex
+// @Description: 查找 path 中第一个通配符的位置 通配符只能出现在片段开头
+// @param path
+// @return int 不存在时返回 -1
+func wildcardIndex(path string) int {
+	for i := 0; i < len(path); i++ {
+		if (path[i] == ':' || path[i] == '*') && (i == 0 || path[i-1] == '/') {
+			return i
+		}
+	}
+	return -1
 }
 
-// matchChild
-// @Description: 第一个匹配成功的节点，用于插入
+// staticChild
+// @Description: 根据首字符查找静态子节点
 // @receiver n
-// @param part
+// @param c
 // @return *node
-func (n *node) matchChild(part string) *node {
-	for _, child := range n.children {
-		// 若 part 等于子节点的 part 或者是模糊匹配就返回子节点
-		if (child.part == part) || child.isWild {
-			return child
+func (n *node) staticChild(c byte) *node {
+	for i := 0; i < len(n.indices); i++ {
+		if n.indices[i] == c {
+			return n.children[i]
 		}
 	}
 	return nil
 }
 
-// matchChildren
-// @Description: 返回所有匹配成功的节点 用于查找
+// insertStatic
+// @Description: 插入一段静态路径 必要时拆分已有节点
 // @receiver n
-// @param part
-// @return []*node
-func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
+// @param path
+// @return *node 静态路径的终点节点
+func (n *node) insertStatic(path string) *node {
+	for path != "" {
+		child := n.staticChild(path[0])
+		if child == nil {
+			child = &node{path: path, nType: static}
+			n.indices += string(path[0])
+			n.children = append(n.children, child)
+			return child
+		}
+		// 只有部分前缀相同时 将子节点拆分为公共前缀和剩余部分两个节点
+		l := longestCommonPrefix(child.path, path)
+		if l < len(child.path) {
+			rest := *child
+			rest.path = child.path[l:]
+			*child = node{
+				path:     child.path[:l],
+				nType:    static,
+				indices:  string(rest.path[0]),
+				children: []*node{&rest},
+			}
 		}
+		n = child
+		path = path[l:]
 	}
-	return nodes
+	return n
 }
 
 // insert
-// @Description:
+// @Description: 插入路由
+// @PS: 同一层的同类通配符名称不同时、同一个路径重复注册时 panic
 // @receiver n
-// @param pattern	待匹配的模式
-// @param parts
-// @param height
-func (n *node) insert(pattern string, parts []string, height int) {
-	// 若深度遍历到了路由的深度 则表示遍历结束
-	if len(parts) == height {
-		n.pattern = pattern
-		return
+// @param path	规范化之后的路由
+// @param pattern	注册时的原始路由
+// @return *node	路由的终点节点
+func (n *node) insert(path string, pattern string) *node {
+	for path != "" {
+		i := wildcardIndex(path)
+		if i != 0 {
+			// 通配符之前的静态部分
+			if i < 0 {
+				i = len(path)
+			}
+			n = n.insertStatic(path[:i])
+			path = path[i:]
+			continue
+		}
+
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		wildcard := path[:end]
+		child := &n.paramNode
+		nType := param
+		if wildcard[0] == '*' {
+			child, nType = &n.wildNode, catchAll
+		}
+		if *child == nil {
+			*child = &node{path: wildcard, nType: nType}
+		} else if (*child).path != wildcard {
+			// 同一层的同类通配符只能有一个 名称不同即冲突 例如 /hello/:name 与 /hello/:id
+			panic(fmt.Sprintf("gee: wildcard '%s' in new path '%s' conflicts with existing wildcard '%s'",
+				wildcard, pattern, (*child).path))
+		}
+		n = *child
+		path = path[end:]
 	}
-	// 获取当前深度的路由的 part 然后去当前节点的子节点中去寻找这个 part
-	// 找得到就说明 已经在子节点中 -> 遍历下一层
-	// 找不到就新增该节点
-	part := parts[height]
-	child := n.matchChild(part) // 找不到这个路由
-	if child == nil {
-		// 若 part 以 : 或 * 开头 则是模糊匹配
-		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
-		// 将当前路由添加到 node 的子节点中
-		n.children = append(n.children, child)
+
+	// 节点上已经注册过路由 例如 /hello 与 /hello/ 规范化后是同一个节点
+	if n.pattern != "" {
+		panic(fmt.Sprintf("gee: path '%s' conflicts with existing route '%s'", pattern, n.pattern))
 	}
-	// 递归 下一层
-	child.insert(pattern, parts, height+1)
+	n.pattern = pattern
+	return n
 }
 
 // search
-// @Description:查找符合路由规则的节点
+// @Description: 查找符合路由规则的节点
+// @PS: 按 静态节点 > :param > *catchall 的优先级查找 失败时回溯 与路由注册顺序无关
 // @receiver n
-// @param parts
-// @param height
+// @param path	当前节点之后剩余的请求路径
+// @param params	匹配到的参数追加到 params 中 为 nil 时不收集参数
 // @return *node
-func (n *node) search(parts []string, height int) *node {
-	// 如果遍历到了最底层 或者 当前节点的 part 是模糊匹配则进入到了最后一次
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
-		// 如果其没有后续路由 则表明匹配失败
+func (n *node) search(path string, params *Params) *node {
+	if path == "" {
 		if n.pattern == "" {
 			return nil
 		}
-		// 返回模糊匹配节点
 		return n
 	}
-	// 遍历 part
-	part := parts[height]
-	// 查找所有符合条件的子节点
-	children := n.matchChildren(part)
-	// 遍历子节点
-	for _, child := range children {
-		// 查找下一个 节点
-		result := child.search(parts, height+1)
-		if result != nil {
+
+	// 静态节点
+	if child := n.staticChild(path[0]); child != nil && strings.HasPrefix(path, child.path) {
+		if result := child.search(path[len(child.path):], params); result != nil {
 			return result
 		}
 	}
-	// 查找失败
+
+	// 参数节点 匹配到下一个 / 为止 且不能为空
+	if child := n.paramNode; child != nil {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			if params != nil {
+				*params = append(*params, Param{Key: child.path[1:], Value: path[:end]})
+			}
+			if result := child.search(path[end:], params); result != nil {
+				return result
+			}
+			// 匹配失败 回溯时移除刚刚追加的参数
+			if params != nil {
+				*params = (*params)[:len(*params)-1]
+			}
+		}
+	}
+
+	// 通配节点 匹配剩余的全部路径
+	if child := n.wildNode; child != nil {
+		if params != nil && len(child.path) > 1 {
+			*params = append(*params, Param{Key: child.path[1:], Value: path})
+		}
+		return child
+	}
 	return nil
 }
@@ -0,0 +1,500 @@
+package gee
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// StructValidator
+// @Description: 结构体校验器 Bind 系列方法绑定成功后会自动调用
+type StructValidator interface {
+	// ValidateStruct obj 不是结构体(或结构体指针)时直接返回 nil
+	ValidateStruct(obj interface{}) error
+}
+
+// Validator 默认的校验器 使用 binding 标签 设置为 nil 时关闭自动校验
+var Validator StructValidator = newDefaultValidator()
+
+// ValidatorFunc
+// @Description: 校验函数
+// @param field	待校验的字段 指针已经解引用
+// @param param	规则参数 例如 min=3 中的 3
+// @return bool	是否校验通过
+type ValidatorFunc func(field reflect.Value, param string) bool
+
+// RegisterValidation
+// @Description: 为默认校验器注册自定义规则 同名时覆盖内置规则
+// @param name	规则名称 在 binding 标签中使用
+// @param fn
+func RegisterValidation(name string, fn ValidatorFunc) {
+	if v, ok := Validator.(*defaultValidator); ok {
+		v.register(name, fn)
+	}
+}
+
+// FieldError
+// @Description: 单个字段的校验错误 可以直接序列化为 JSON
+type FieldError struct {
+	Field   string `json:"field"`           // 字段路径 优先使用 json 标签 例如 users[0].name
+	Tag     string `json:"tag"`             // 未通过的规则 例如 min
+	Param   string `json:"param,omitempty"` // 规则参数 例如 3
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors 所有未通过校验的字段
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, len(ve))
+	for i, e := range ve {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// rule 一条校验规则
+type rule struct {
+	name  string
+	param string
+}
+
+// fieldRules 结构体字段的校验规则
+type fieldRules struct {
+	index   int
+	name    string // 错误中使用的字段名
+	rules   []rule // dive 之前的规则 作用于字段本身
+	dive    []rule // dive 之后的规则 作用于切片、数组、map 的每个元素
+	hasDive bool
+}
+
+// defaultValidator
+// @Description: 基于 binding 标签的校验器
+// @PS: 标签格式为 `binding:"required,min=3,max=20,email,oneof=a b"` 嵌套结构体及结构体切片会递归校验
+// @PS: dive 之后的规则作用于切片元素 例如 `binding:"max=5,dive,min=1"`
+type defaultValidator struct {
+	mu         sync.RWMutex
+	validators map[string]ValidatorFunc
+	cache      sync.Map // reflect.Type -> *typeRules
+}
+
+// typeRules 缓存的解析结果 标签有误时同样缓存错误
+type typeRules struct {
+	fields []fieldRules
+	err    error
+}
+
+func newDefaultValidator() *defaultValidator {
+	v := &defaultValidator{validators: make(map[string]ValidatorFunc)}
+	for name, fn := range builtinValidators {
+		v.validators[name] = fn
+	}
+	return v
+}
+
+func (v *defaultValidator) register(name string, fn ValidatorFunc) {
+	v.mu.Lock()
+	v.validators[name] = fn
+	v.mu.Unlock()
+}
+
+func (v *defaultValidator) lookup(name string) (ValidatorFunc, bool) {
+	v.mu.RLock()
+	fn, ok := v.validators[name]
+	v.mu.RUnlock()
+	return fn, ok
+}
+
+// ValidateStruct
+// @Description: 校验结构体
+// @receiver v
+// @param obj
+// @return error	校验失败时为 ValidationErrors binding 标签中使用了未定义的规则时返回对应的错误
+func (v *defaultValidator) ValidateStruct(obj interface{}) error {
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	if err := v.validateStruct(value, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// parseRules
+// @Description: 解析结构体类型中所有字段的规则 结果按类型缓存
+// @PS: 第一次解析时会一并解析字段中嵌套的结构体类型 标签有误时在第一次校验就返回错误 而不是等到嵌套的值出现
+// @receiver v
+// @param typ
+// @param visiting	正在解析的类型 用于跳过自引用的类型 可以为 nil
+// @return []fieldRules
+// @return error
+func (v *defaultValidator) parseRules(typ reflect.Type, visiting map[reflect.Type]bool) ([]fieldRules, error) {
+	if cached, ok := v.cache.Load(typ); ok {
+		entry := cached.(*typeRules)
+		return entry.fields, entry.err
+	}
+	if visiting[typ] {
+		return nil, nil
+	}
+	if visiting == nil {
+		visiting = make(map[reflect.Type]bool)
+	}
+	visiting[typ] = true
+	fields, err := v.buildRules(typ, visiting)
+	delete(visiting, typ)
+	v.cache.Store(typ, &typeRules{fields: fields, err: err})
+	return fields, err
+}
+
+// buildRules 解析 typ 的字段规则 并检查嵌套的结构体类型
+func (v *defaultValidator) buildRules(typ reflect.Type, visiting map[reflect.Type]bool) ([]fieldRules, error) {
+	fields := make([]fieldRules, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("binding")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		fr := fieldRules{index: i, name: fieldName(field)}
+		if tag != "" {
+			for _, item := range strings.Split(tag, ",") {
+				if item == "dive" {
+					fr.hasDive = true
+					continue
+				}
+				r := rule{name: item}
+				if j := strings.IndexByte(item, '='); j >= 0 {
+					r.name, r.param = item[:j], item[j+1:]
+				}
+				if _, ok := v.lookup(r.name); !ok && r.name != "omitempty" {
+					return nil, fmt.Errorf("gee: undefined validation '%s' on field %s.%s", r.name, typ.Name(), field.Name)
+				}
+				if fr.hasDive {
+					fr.dive = append(fr.dive, r)
+				} else {
+					fr.rules = append(fr.rules, r)
+				}
+			}
+		}
+		if nested := nestedStructType(field.Type); nested != nil {
+			if _, err := v.parseRules(nested, visiting); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, fr)
+	}
+	return fields, nil
+}
+
+// nestedStructType 字段中可能需要递归校验的结构体类型 包括指针以及切片、数组、map 的元素
+func nestedStructType(typ reflect.Type) reflect.Type {
+	for {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			typ = typ.Elem()
+		case reflect.Struct:
+			if typ == timeType {
+				return nil
+			}
+			return typ
+		default:
+			return nil
+		}
+	}
+}
+
+// fieldName 错误中使用的字段名 优先使用 json 标签
+func fieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// validateStruct 校验结构体的每个字段
+func (v *defaultValidator) validateStruct(value reflect.Value, namespace string, errs *ValidationErrors) error {
+	typ := value.Type()
+	rules, err := v.parseRules(typ, nil)
+	if err != nil {
+		return err
+	}
+	for _, fr := range rules {
+		// 匿名字段的字段直接挂在外层结构体下
+		path := fr.name
+		if typ.Field(fr.index).Anonymous {
+			path = namespace
+		} else if namespace != "" {
+			path = namespace + "." + fr.name
+		}
+		field := value.Field(fr.index)
+		if !v.validateValue(field, fr.rules, path, errs) {
+			continue
+		}
+		if fr.hasDive {
+			err = v.validateElems(field, fr.dive, path, errs)
+		} else {
+			err = v.validateNested(field, path, errs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateValue
+// @Description: 按规则校验单个值
+// @return bool 是否需要继续校验嵌套的结构体或元素
+func (v *defaultValidator) validateValue(field reflect.Value, rules []rule, path string, errs *ValidationErrors) bool {
+	for _, r := range rules {
+		switch r.name {
+		case "omitempty":
+			if isEmpty(field) {
+				return false
+			}
+			continue
+		case "required":
+			if isEmpty(field) {
+				*errs = append(*errs, newFieldError(path, r, field))
+				return false
+			}
+			continue
+		}
+		// 其余规则作用于指针指向的值 nil 指针不校验
+		elem := indirect(field)
+		if !elem.IsValid() {
+			return false
+		}
+		fn, _ := v.lookup(r.name)
+		if !fn(elem, r.param) {
+			*errs = append(*errs, newFieldError(path, r, elem))
+		}
+	}
+	return true
+}
+
+// validateNested 递归校验嵌套的结构体以及结构体的切片、数组、map
+func (v *defaultValidator) validateNested(field reflect.Value, path string, errs *ValidationErrors) error {
+	field = indirect(field)
+	if !field.IsValid() {
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Struct:
+		if field.Type() != timeType {
+			return v.validateStruct(field, path, errs)
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		// 只有元素可能包含结构体时才需要逐个校验
+		elemType := field.Type().Elem()
+		for elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		switch elemType.Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+			return v.validateElems(field, nil, path, errs)
+		}
+	}
+	return nil
+}
+
+// validateElems 校验切片、数组、map 中的每个元素
+func (v *defaultValidator) validateElems(field reflect.Value, rules []rule, path string, errs *ValidationErrors) error {
+	field = indirect(field)
+	if !field.IsValid() {
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if v.validateValue(field.Index(i), rules, elemPath, errs) {
+				if err := v.validateNested(field.Index(i), elemPath, errs); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Map:
+		iter := field.MapRange()
+		for iter.Next() {
+			elemPath := fmt.Sprintf("%s[%v]", path, iter.Key().Interface())
+			if v.validateValue(iter.Value(), rules, elemPath, errs) {
+				if err := v.validateNested(iter.Value(), elemPath, errs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// indirect 解引用指针和接口 nil 时返回无效的 Value
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// isEmpty 值是否为空 切片和 map 长度为 0 时也视为空
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return value.IsZero()
+}
+
+// newFieldError 生成字段错误及其描述
+func newFieldError(path string, r rule, value reflect.Value) FieldError {
+	var message string
+	switch r.name {
+	case "required":
+		message = fmt.Sprintf("%s is required", path)
+	case "min", "gte":
+		message = fmt.Sprintf("%s must be at least %s%s", path, r.param, unitOf(value))
+	case "max", "lte":
+		message = fmt.Sprintf("%s must be at most %s%s", path, r.param, unitOf(value))
+	case "gt":
+		message = fmt.Sprintf("%s must be greater than %s%s", path, r.param, unitOf(value))
+	case "lt":
+		message = fmt.Sprintf("%s must be less than %s%s", path, r.param, unitOf(value))
+	case "len":
+		message = fmt.Sprintf("%s must be exactly %s%s", path, r.param, unitOf(value))
+	case "eq":
+		message = fmt.Sprintf("%s must be equal to %s", path, r.param)
+	case "ne":
+		message = fmt.Sprintf("%s must not be equal to %s", path, r.param)
+	case "oneof":
+		message = fmt.Sprintf("%s must be one of [%s]", path, r.param)
+	case "email", "url":
+		message = fmt.Sprintf("%s must be a valid %s", path, r.name)
+	default:
+		message = fmt.Sprintf("%s failed on the '%s' rule", path, r.name)
+	}
+	return FieldError{Field: path, Tag: r.name, Param: r.param, Message: message}
+}
+
+// unitOf 长度类规则在描述中使用的单位
+func unitOf(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
+	}
+	return ""
+}
+
+// builtinValidators 内置的校验规则 required 与 omitempty 在 validateValue 中单独处理
+var builtinValidators = map[string]ValidatorFunc{
+	"required": func(reflect.Value, string) bool { return true },
+	"min":      compareRule(func(a, b float64) bool { return a >= b }),
+	"gte":      compareRule(func(a, b float64) bool { return a >= b }),
+	"max":      compareRule(func(a, b float64) bool { return a <= b }),
+	"lte":      compareRule(func(a, b float64) bool { return a <= b }),
+	"gt":       compareRule(func(a, b float64) bool { return a > b }),
+	"lt":       compareRule(func(a, b float64) bool { return a < b }),
+	"len":      compareRule(func(a, b float64) bool { return a == b }),
+	"eq":       equalRule,
+	"ne": func(field reflect.Value, param string) bool {
+		return !equalRule(field, param)
+	},
+	"oneof": func(field reflect.Value, param string) bool {
+		value := fmt.Sprint(field.Interface())
+		for _, option := range strings.Fields(param) {
+			if value == option {
+				return true
+			}
+		}
+		return false
+	},
+	"email":    regexpRule(emailRegexp),
+	"alpha":    regexpRule(regexp.MustCompile(`^[a-zA-Z]+$`)),
+	"alphanum": regexpRule(regexp.MustCompile(`^[a-zA-Z0-9]+$`)),
+	"numeric":  regexpRule(regexp.MustCompile(`^[-+]?[0-9]+(?:\.[0-9]+)?$`)),
+	"url": func(field reflect.Value, _ string) bool {
+		if field.Kind() != reflect.String {
+			return false
+		}
+		u, err := url.Parse(field.String())
+		return err == nil && u.Scheme != "" && u.Host != ""
+	},
+}
+
+var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
+// measure 字符串取字符数 切片、数组、map 取长度 数字取数值 time.Duration 按 ParseDuration 解析参数
+func measure(field reflect.Value, param string) (value float64, limit float64, ok bool) {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(param)
+		return float64(field.Int()), float64(d), err == nil
+	}
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(field.String())), limit, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(field.Len()), limit, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int()), limit, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint()), limit, true
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), limit, true
+	}
+	return 0, 0, false
+}
+
+// compareRule 生成比较大小或长度的规则
+func compareRule(compare func(value, limit float64) bool) ValidatorFunc {
+	return func(field reflect.Value, param string) bool {
+		value, limit, ok := measure(field, param)
+		return ok && compare(value, limit)
+	}
+}
+
+// equalRule 字符串比较内容 其余类型比较 measure 的结果
+func equalRule(field reflect.Value, param string) bool {
+	if field.Kind() == reflect.String {
+		return field.String() == param
+	}
+	value, limit, ok := measure(field, param)
+	return ok && value == limit
+}
+
+// regexpRule 生成正则匹配字符串的规则
+func regexpRule(re *regexp.Regexp) ValidatorFunc {
+	return func(field reflect.Value, _ string) bool {
+		return field.Kind() == reflect.String && re.MatchString(field.String())
+	}
+}
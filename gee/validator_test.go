@@ -0,0 +1,122 @@
+package gee
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validateAddress struct {
+	City string `json:"city" binding:"required"`
+	Zip  string `json:"zip" binding:"omitempty,len=6,numeric"`
+}
+
+type validateUser struct {
+	Name     string            `json:"name" binding:"required,min=3,max=20"`
+	Email    string            `json:"email" binding:"required,email"`
+	Role     string            `json:"role" binding:"oneof=admin user"`
+	Age      *int              `json:"age" binding:"omitempty,gte=0,lte=150"`
+	Tags     []string          `json:"tags" binding:"max=3,dive,min=2"`
+	Address  validateAddress   `json:"address"`
+	Backups  []validateAddress `json:"backups"`
+	Nickname string            `json:"nickname" binding:"omitempty,lowercase"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	RegisterValidation("lowercase", func(field reflect.Value, _ string) bool {
+		return field.String() == strings.ToLower(field.String())
+	})
+
+	age := 200
+	user := validateUser{
+		Name:     "ge",
+		Email:    "gee@example",
+		Role:     "root",
+		Age:      &age,
+		Tags:     []string{"go", "x"},
+		Backups:  []validateAddress{{City: "Beijing", Zip: "1000"}},
+		Nickname: "Gee",
+	}
+	err := Validator.ValidateStruct(&user)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expect ValidationErrors, got %v", err)
+	}
+
+	want := map[string]string{
+		"name":           "min",
+		"email":          "email",
+		"role":           "oneof",
+		"age":            "lte",
+		"tags[1]":        "min",
+		"address.city":   "required",
+		"backups[0].zip": "len",
+		"nickname":       "lowercase",
+	}
+	got := make(map[string]string)
+	for _, e := range errs {
+		got[e.Field] = e.Tag
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got errors %v, want %v", got, want)
+	}
+
+	valid := validateUser{Name: "gee", Email: "gee@example.com", Role: "admin", Address: validateAddress{City: "Beijing"}}
+	if err := Validator.ValidateStruct(&valid); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestBindValidate(t *testing.T) {
+	r := New()
+	r.POST("/users", func(c *Context) {
+		var user validateUser
+		if err := c.Bind(&user); err != nil {
+			c.JSON(http.StatusBadRequest, H{"errors": err})
+			return
+		}
+		c.String(http.StatusOK, user.Name)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"gee","role":"admin"}`))
+	req.Header.Set("Content-Type", MIMEJSON)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400, got %d", w.Code)
+	}
+
+	var body struct {
+		Errors []FieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Errors) != 2 || body.Errors[0].Field != "email" || body.Errors[1].Field != "address.city" {
+		t.Fatalf("unexpected errors %+v", body.Errors)
+	}
+}
+
+type validateTypo struct {
+	Name  string `binding:"required"`
+	Inner *struct {
+		Code string `binding:"requird"`
+	}
+}
+
+func TestValidateUndefinedRule(t *testing.T) {
+	// 嵌套字段为 nil 时也要在第一次校验时发现拼写错误 并且不能 panic
+	c := &Context{Req: httptest.NewRequest(http.MethodGet, "/?Name=gee", nil)}
+	var typo validateTypo
+	err := c.Bind(&typo)
+	if err == nil || !strings.Contains(err.Error(), "undefined validation 'requird'") {
+		t.Fatalf("Bind() error = %v", err)
+	}
+	// 错误被缓存 再次校验返回相同的错误
+	if err2 := Validator.ValidateStruct(&typo); err2 == nil || err2.Error() != err.Error() {
+		t.Fatalf("ValidateStruct() error = %v, want %v", err2, err)
+	}
+}
@@ -0,0 +1,626 @@
+package gee
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket 消息类型 即 RFC 6455 中的 opcode
+const (
+	continuationFrame = 0
+	TextMessage       = 1
+	BinaryMessage     = 2
+	CloseMessage      = 8
+	PingMessage       = 9
+	PongMessage       = 10
+)
+
+// WebSocket 关闭状态码 见 RFC 6455 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	// wsGUID 计算 Sec-WebSocket-Accept 使用的固定值
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// maxControlPayload 控制帧的负载最多 125 字节
+	maxControlPayload = 125
+	// defaultWSReadLimit 默认单条消息的最大字节数
+	defaultWSReadLimit = 32 << 20 // 32 MB
+	// maxWSFrameLength 不限制消息大小时 单帧负载长度的上限
+	maxWSFrameLength = math.MaxInt32
+)
+
+// ErrWSClosed 已经发送关闭帧后 不能再写入数据
+var ErrWSClosed = errors.New("gee: websocket connection closed")
+
+// WSHandler WebSocket 处理器 返回后连接会被关闭
+type WSHandler func(conn *WSConn)
+
+// CloseError
+// @Description: 收到对方的关闭帧 或者因为对方违反协议而关闭连接
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return "gee: websocket closed: " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// WSConn
+// @Description: 一个 WebSocket 连接
+// @PS: 同一时间只能有一个 goroutine 读取 写入可以在多个 goroutine 中并发进行
+type WSConn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	bw       *bufio.Writer
+	isServer bool // 客户端发送的帧必须掩码 服务端发送的帧不能掩码
+	ctx      *Context
+
+	writeMu   sync.Mutex // 保证每一帧完整写入
+	messageMu sync.Mutex // 保证分片消息的各帧连续写入
+	closeSent bool
+	closeOnce sync.Once
+
+	readLimit   int64
+	readClosed  bool // 收到关闭帧或对方违反协议后不再读取
+	pingHandler func(data string) error
+	pongHandler func(data string) error
+}
+
+// newWSConn 使用已经完成握手的连接创建 WSConn
+func newWSConn(conn net.Conn, br *bufio.Reader, bw *bufio.Writer, isServer bool) *WSConn {
+	ws := &WSConn{
+		conn:      conn,
+		br:        br,
+		bw:        bw,
+		isServer:  isServer,
+		readLimit: defaultWSReadLimit,
+	}
+	ws.pingHandler = func(data string) error {
+		err := ws.writeControl(PongMessage, []byte(data))
+		if err == ErrWSClosed {
+			return nil
+		}
+		return err
+	}
+	ws.pongHandler = func(string) error { return nil }
+	return ws
+}
+
+// WS
+// @Description: 注册 WebSocket 路由 分组的中间件在升级协议之前执行 中间件 Abort 时不会升级
+// @receiver group
+// @param pattern
+// @param handler
+// @param middlewares	只作用于该路由的中间件
+func (group *RouterGroup) WS(pattern string, handler WSHandler, middlewares ...HandlerFunc) {
+	// 复制一份 避免 append 写入调用方传入的切片
+	handlers := make([]HandlerFunc, 0, len(middlewares)+1)
+	handlers = append(handlers, middlewares...)
+	handlers = append(handlers, wsUpgradeHandler(handler))
+	group.GET(pattern, handlers...)
+}
+
+// wsUpgradeHandler 完成握手后调用 handler 握手失败时返回 4xx
+func wsUpgradeHandler(handler WSHandler) HandlerFunc {
+	return func(c *Context) {
+		conn, err := c.upgradeWebSocket()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}
+}
+
+// upgradeWebSocket
+// @Description: 校验握手请求 通过 Hijacker 接管连接并返回 101
+// @PS: 校验失败时已经写入了错误响应
+// @receiver c
+// @return *WSConn
+// @return error
+func (c *Context) upgradeWebSocket() (*WSConn, error) {
+	req := c.Req
+	fail := func(code int, msg string) (*WSConn, error) {
+		err := errors.New("gee: websocket: " + msg)
+		c.Fail(code, err.Error())
+		return nil, err
+	}
+	if req.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "request method is not GET")
+	}
+	if !headerContainsToken(req.Header, "Connection", "upgrade") {
+		return fail(http.StatusBadRequest, "'upgrade' token not found in 'Connection' header")
+	}
+	if !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "'websocket' token not found in 'Upgrade' header")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.SetHeader("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid 'Sec-WebSocket-Key' header")
+	}
+	checkOrigin := checkSameOrigin
+	if c.engine != nil && c.engine.CheckWSOrigin != nil {
+		checkOrigin = c.engine.CheckWSOrigin
+	}
+	if !checkOrigin(req) {
+		return fail(http.StatusForbidden, "request origin not allowed")
+	}
+
+	c.Status(http.StatusSwitchingProtocols)
+	netConn, rw, err := c.Writer.Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, err.Error())
+	}
+	// 清除 http.Server 设置的超时 之后由调用方通过 SetReadDeadline 等控制
+	_ = netConn.SetDeadline(time.Time{})
+
+	// 中间件设置的响应头(例如 Set-Cookie)也一并发送
+	header := c.Writer.Header()
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", wsAcceptKey(key))
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	rw.Writer.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(rw.Writer)
+	rw.Writer.WriteString("\r\n")
+	if err := rw.Writer.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	conn := newWSConn(netConn, rw.Reader, rw.Writer, true)
+	conn.ctx = c
+	return conn, nil
+}
+
+// wsAcceptKey 计算 Sec-WebSocket-Accept
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContainsToken 请求头中逗号分隔的值是否包含 token 忽略大小写
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header[name] {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkSameOrigin 默认只允许同源的浏览器请求 没有 Origin 头的请求(非浏览器客户端)直接放行
+func checkSameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+// Context 升级时的 Context 可以读取路由参数以及中间件设置的值 只在 WSHandler 返回前有效
+func (conn *WSConn) Context() *Context {
+	return conn.ctx
+}
+
+func (conn *WSConn) RemoteAddr() net.Addr {
+	return conn.conn.RemoteAddr()
+}
+
+func (conn *WSConn) SetReadDeadline(t time.Time) error {
+	return conn.conn.SetReadDeadline(t)
+}
+
+func (conn *WSConn) SetWriteDeadline(t time.Time) error {
+	return conn.conn.SetWriteDeadline(t)
+}
+
+// SetReadLimit 设置单条消息的最大字节数 超出时以 1009 关闭连接 小于等于 0 时不限制消息大小 单帧依然不能超过 maxWSFrameLength
+func (conn *WSConn) SetReadLimit(limit int64) {
+	conn.readLimit = limit
+}
+
+// SetPingHandler 设置收到 Ping 时的处理器 默认回复内容相同的 Pong
+func (conn *WSConn) SetPingHandler(h func(data string) error) {
+	conn.pingHandler = h
+}
+
+// SetPongHandler 设置收到 Pong 时的处理器 常用于配合 SetReadDeadline 检测心跳
+func (conn *WSConn) SetPongHandler(h func(data string) error) {
+	conn.pongHandler = h
+}
+
+// ReadMessage
+// @Description: 读取一条完整的消息 分片的消息会被合并 期间收到的控制帧会被自动处理
+// @PS: 收到关闭帧时回复关闭帧并返回 *CloseError 对方违反协议时以对应的状态码关闭连接并返回 *CloseError
+// @receiver conn
+// @return messageType	TextMessage 或 BinaryMessage
+// @return data
+// @return err
+func (conn *WSConn) ReadMessage() (messageType int, data []byte, err error) {
+	if conn.readClosed {
+		return 0, nil, ErrWSClosed
+	}
+	messageType = -1
+	for {
+		fin, opcode, payload, err := conn.readFrame(int64(len(data)))
+		if err != nil {
+			return 0, nil, conn.fail(err)
+		}
+		switch opcode {
+		case PingMessage:
+			if err := conn.pingHandler(string(payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err := conn.pongHandler(string(payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, conn.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != -1 {
+				return 0, nil, conn.fail(&CloseError{Code: CloseProtocolError, Text: "expected continuation frame"})
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == -1 {
+				return 0, nil, conn.fail(&CloseError{Code: CloseProtocolError, Text: "unexpected continuation frame"})
+			}
+		}
+		data = append(data, payload...)
+		if fin {
+			break
+		}
+	}
+	if messageType == TextMessage && !utf8.Valid(data) {
+		return 0, nil, conn.fail(&CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid utf8 payload in text message"})
+	}
+	return messageType, data, nil
+}
+
+// ReadJSON 读取一条消息并解码为 JSON
+func (conn *WSConn) ReadJSON(obj interface{}) error {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// readFrame
+// @Description: 读取一帧并校验帧头
+// @receiver conn
+// @param received	当前消息已经读取的字节数 用于检查 readLimit
+// @return fin
+// @return opcode
+// @return payload	已经去除掩码
+// @return err
+func (conn *WSConn) readFrame(received int64) (fin bool, opcode int, payload []byte, err error) {
+	var head [8]byte
+	if _, err = io.ReadFull(conn.br, head[:2]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	masked := head[1]&0x80 != 0
+	length := int64(head[1] & 0x7f)
+
+	protocolError := func(text string) (bool, int, []byte, error) {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Text: text}
+	}
+	if head[0]&0x70 != 0 {
+		return protocolError("reserved bits set without negotiated extension")
+	}
+	switch opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !fin {
+			return protocolError("fragmented control frame")
+		}
+		if length > maxControlPayload {
+			return protocolError("control frame payload too large")
+		}
+	default:
+		return protocolError("unknown opcode " + strconv.Itoa(opcode))
+	}
+	if masked != conn.isServer {
+		if conn.isServer {
+			return protocolError("client frame is not masked")
+		}
+		return protocolError("server frame is masked")
+	}
+
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(conn.br, head[:2]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(head[:2]))
+	case 127:
+		if _, err = io.ReadFull(conn.br, head[:8]); err != nil {
+			return
+		}
+		if head[0]&0x80 != 0 {
+			return protocolError("invalid payload length")
+		}
+		length = int64(binary.BigEndian.Uint64(head[:8]))
+	}
+	// 用减法比较 避免 received+length 溢出
+	if length > maxWSFrameLength || conn.readLimit > 0 && opcode < CloseMessage && length > conn.readLimit-received {
+		return false, 0, nil, &CloseError{Code: CloseMessageTooBig, Text: "message exceeds read limit"}
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(conn.br, key[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(conn.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// handleClose 解析对方的关闭帧 并回复相同的状态码
+func (conn *WSConn) handleClose(payload []byte) error {
+	conn.readClosed = true
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return conn.fail(&CloseError{Code: CloseProtocolError, Text: "invalid close payload"})
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return conn.fail(&CloseError{Code: CloseProtocolError, Text: "invalid close code"})
+		}
+		if !utf8.Valid(payload[2:]) {
+			return conn.fail(&CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid utf8 payload in close frame"})
+		}
+	}
+	code := closeErr.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	_ = conn.WriteClose(code, "")
+	return closeErr
+}
+
+// fail 对方违反协议时发送关闭帧 读取错误直接返回
+func (conn *WSConn) fail(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		conn.readClosed = true
+		_ = conn.WriteClose(closeErr.Code, closeErr.Text)
+	}
+	return err
+}
+
+// validCloseCode 关闭帧中允许出现的状态码
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < 1000 || code > 1011:
+		return false
+	}
+	return code != 1004 && code != CloseNoStatusReceived && code != CloseAbnormalClosure
+}
+
+// WriteMessage
+// @Description: 写入一条消息
+// @receiver conn
+// @param messageType	TextMessage、BinaryMessage、PingMessage、PongMessage
+// @param data
+// @return error
+func (conn *WSConn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+		conn.messageMu.Lock()
+		defer conn.messageMu.Unlock()
+		return conn.writeFrame(messageType, true, data)
+	case PingMessage, PongMessage:
+		return conn.writeControl(messageType, data)
+	case CloseMessage:
+		return errors.New("gee: websocket: use WriteClose to send close frame")
+	}
+	return errors.New("gee: websocket: unknown message type " + strconv.Itoa(messageType))
+}
+
+// WriteJSON 编码为 JSON 后作为文本消息写入
+func (conn *WSConn) WriteJSON(obj interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(TextMessage, data)
+}
+
+// Ping 发送 Ping 对方回复的 Pong 由 SetPongHandler 设置的处理器处理
+func (conn *WSConn) Ping(data []byte) error {
+	return conn.writeControl(PingMessage, data)
+}
+
+// NextWriter
+// @Description: 以分片的方式写入一条消息 每次 Write 发送一帧 Close 时发送结束帧
+// @PS: Close 之前其他 goroutine 写入数据消息会被阻塞 控制帧不受影响
+// @receiver conn
+// @param messageType	TextMessage 或 BinaryMessage
+// @return io.WriteCloser
+func (conn *WSConn) NextWriter(messageType int) io.WriteCloser {
+	conn.messageMu.Lock()
+	return &wsFragmentWriter{conn: conn, opcode: messageType}
+}
+
+type wsFragmentWriter struct {
+	conn   *WSConn
+	opcode int
+	closed bool
+}
+
+func (w *wsFragmentWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrWSClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.conn.writeFrame(w.opcode, false, p); err != nil {
+		return 0, err
+	}
+	w.opcode = continuationFrame
+	return len(p), nil
+}
+
+func (w *wsFragmentWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.conn.messageMu.Unlock()
+	return w.conn.writeFrame(w.opcode, true, nil)
+}
+
+// WriteClose
+// @Description: 发送关闭帧 之后不能再写入数据
+// @receiver conn
+// @param code
+// @param text
+// @return error
+func (conn *WSConn) WriteClose(code int, text string) error {
+	var payload []byte
+	if code != CloseNoStatusReceived {
+		payload = make([]byte, 2+len(text))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		copy(payload[2:], text)
+	}
+	return conn.writeControl(CloseMessage, payload)
+}
+
+// Close
+// @Description: 发送关闭帧后关闭底层连接 可以重复调用
+// @PS: Close 不会读取连接 可以与正在阻塞在 ReadMessage 中的 goroutine 并发调用 该 goroutine 会收到连接关闭的错误
+// @receiver conn
+// @return error
+func (conn *WSConn) Close() error {
+	err := ErrWSClosed
+	conn.closeOnce.Do(func() {
+		_ = conn.WriteClose(CloseNormalClosure, "")
+		err = conn.conn.Close()
+	})
+	return err
+}
+
+// writeControl 写入控制帧
+func (conn *WSConn) writeControl(opcode int, payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return errors.New("gee: websocket: control frame payload too large")
+	}
+	return conn.writeFrame(opcode, true, payload)
+}
+
+// writeFrame 写入一帧 客户端发送的帧使用随机的掩码
+func (conn *WSConn) writeFrame(opcode int, fin bool, payload []byte) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	if conn.closeSent {
+		return ErrWSClosed
+	}
+	if opcode == CloseMessage {
+		conn.closeSent = true
+	}
+
+	var head [14]byte
+	head[0] = byte(opcode)
+	if fin {
+		head[0] |= 0x80
+	}
+	n := 2
+	switch length := len(payload); {
+	case length <= 125:
+		head[1] = byte(length)
+	case length <= 0xffff:
+		head[1] = 126
+		binary.BigEndian.PutUint16(head[2:], uint16(length))
+		n += 2
+	default:
+		head[1] = 127
+		binary.BigEndian.PutUint64(head[2:], uint64(length))
+		n += 8
+	}
+	if !conn.isServer {
+		head[1] |= 0x80
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		copy(head[n:], key[:])
+		n += 4
+		masked := make([]byte, len(payload))
+		copy(masked, payload)
+		maskBytes(key, masked)
+		payload = masked
+	}
+
+	if _, err := conn.bw.Write(head[:n]); err != nil {
+		return err
+	}
+	if _, err := conn.bw.Write(payload); err != nil {
+		return err
+	}
+	return conn.bw.Flush()
+}
+
+// maskBytes 使用掩码对数据做异或 两次异或即可还原
+func maskBytes(key [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= key[i&3]
+	}
+}
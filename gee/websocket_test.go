@@ -0,0 +1,310 @@
+package gee
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWS 回环测试使用的 WebSocket 客户端
+func dialWS(t *testing.T, ts *httptest.Server, path string, header http.Header) (*WSConn, *http.Response) {
+	t.Helper()
+	netConn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 16)
+	rand.Read(key)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(netConn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		netConn.Close()
+		return nil, resp
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(req.Header.Get("Sec-WebSocket-Key")) {
+		t.Fatalf("Sec-WebSocket-Accept = %q", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	conn := newWSConn(netConn, br, bufio.NewWriter(netConn), false)
+	t.Cleanup(func() { netConn.Close() })
+	return conn, resp
+}
+
+func newWSServer() *httptest.Server {
+	r := New()
+	api := r.Group("/api")
+	api.Use(func(c *Context) {
+		if c.Query("token") != "secret" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("user", "geektutu")
+		c.SetHeader("X-Request-Id", "1")
+	})
+	api.WS("/echo/:room", func(conn *WSConn) {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == "whoami" {
+				data = []byte(conn.Context().GetString("user") + "@" + conn.Context().Param("room"))
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	})
+	api.WS("/limit", func(conn *WSConn) {
+		conn.SetReadLimit(8)
+		conn.ReadMessage()
+	})
+	api.WS("/unlimited", func(conn *WSConn) {
+		conn.SetReadLimit(0)
+		conn.ReadMessage()
+	})
+	return httptest.NewServer(r)
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	ts := newWSServer()
+	defer ts.Close()
+	conn, resp := dialWS(t, ts, "/api/echo/go?token=secret", nil)
+	if conn == nil {
+		t.Fatalf("upgrade failed: %d", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Request-Id") != "1" {
+		t.Fatal("headers set by middleware were not sent")
+	}
+
+	large := strings.Repeat("x", 70000)
+	messages := []struct {
+		messageType int
+		data        string
+	}{
+		{TextMessage, "hello"},
+		{BinaryMessage, "\x00\x01\x02"},
+		{TextMessage, strings.Repeat("y", 300)},
+		{BinaryMessage, large},
+		{TextMessage, "whoami"},
+	}
+	for _, m := range messages {
+		if err := conn.WriteMessage(m.messageType, []byte(m.data)); err != nil {
+			t.Fatal(err)
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := m.data
+		if want == "whoami" {
+			want = "geektutu@go"
+		}
+		if messageType != m.messageType || string(data) != want {
+			t.Fatalf("echo = %d %.20q, want %d %.20q", messageType, data, m.messageType, want)
+		}
+	}
+}
+
+func TestWebSocketFragmentsAndPing(t *testing.T) {
+	ts := newWSServer()
+	defer ts.Close()
+	conn, _ := dialWS(t, ts, "/api/echo/go?token=secret", nil)
+
+	pong := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pong <- data
+		return nil
+	})
+	// 分片消息中间插入 Ping 服务端应当先回复 Pong 再合并分片
+	w := conn.NextWriter(TextMessage)
+	w.Write([]byte("hel"))
+	if err := conn.Ping([]byte("beat")); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("lo, "))
+	w.Write([]byte("世界"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != TextMessage || string(data) != "hello, 世界" {
+		t.Fatalf("echo = %d %q", messageType, data)
+	}
+	select {
+	case data := <-pong:
+		if data != "beat" {
+			t.Fatalf("pong = %q", data)
+		}
+	default:
+		t.Fatal("pong was not received before the echo")
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	ts := newWSServer()
+	defer ts.Close()
+
+	conn, _ := dialWS(t, ts, "/api/echo/go?token=secret", nil)
+	if err := conn.WriteClose(CloseGoingAway, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway {
+		t.Fatalf("ReadMessage() error = %v, want close %d", err, CloseGoingAway)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("late")); err != ErrWSClosed {
+		t.Fatalf("WriteMessage() after close = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		code  int
+	}{
+		{"unmasked", []byte{0x81, 0x01, 'a'}, CloseProtocolError},
+		{"reserved bits", []byte{0xc1, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"unknown opcode", []byte{0x83, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"fragmented ping", []byte{0x09, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"continuation", []byte{0x80, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"invalid utf8", []byte{0x81, 0x81, 0, 0, 0, 0, 0xff}, CloseInvalidFramePayloadData},
+		{"invalid close code", []byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xed}, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		conn, _ := dialWS(t, ts, "/api/echo/go?token=secret", nil)
+		conn.bw.Write(tt.frame)
+		conn.bw.Flush()
+		_, _, err := conn.ReadMessage()
+		if !errors.As(err, &closeErr) || closeErr.Code != tt.code {
+			t.Errorf("%s: ReadMessage() error = %v, want close %d", tt.name, err, tt.code)
+		}
+	}
+
+	conn, _ = dialWS(t, ts, "/api/limit?token=secret", nil)
+	conn.WriteMessage(BinaryMessage, []byte("123456789"))
+	_, _, err = conn.ReadMessage()
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseMessageTooBig {
+		t.Fatalf("ReadMessage() error = %v, want close %d", err, CloseMessageTooBig)
+	}
+
+	// 声明长度为 2^63-1 的帧 不能溢出限制检查 也不能在分配内存时 panic
+	huge := []byte{0x82, 0xff, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}
+	for _, path := range []string{"/api/limit?token=secret", "/api/unlimited?token=secret"} {
+		conn, _ = dialWS(t, ts, path, nil)
+		conn.bw.Write(huge)
+		conn.bw.Flush()
+		_, _, err = conn.ReadMessage()
+		if !errors.As(err, &closeErr) || closeErr.Code != CloseMessageTooBig {
+			t.Fatalf("%s: ReadMessage() error = %v, want close %d", path, err, CloseMessageTooBig)
+		}
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	ts := newWSServer()
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		code   int
+	}{
+		{"middleware abort", "/api/echo/go", nil, http.StatusUnauthorized},
+		{"version", "/api/echo/go?token=secret", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"upgrade", "/api/echo/go?token=secret", http.Header{"Upgrade": {"h2c"}}, http.StatusBadRequest},
+		{"key", "/api/echo/go?token=secret", http.Header{"Sec-Websocket-Key": {"short"}}, http.StatusBadRequest},
+		{"cross origin", "/api/echo/go?token=secret", http.Header{"Origin": {"http://evil.example"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		conn, resp := dialWS(t, ts, tt.path, tt.header)
+		if conn != nil || resp.StatusCode != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.code)
+		}
+	}
+
+	conn, _ := dialWS(t, ts, "/api/echo/go?token=secret", http.Header{"Origin": {ts.URL}})
+	if conn == nil {
+		t.Fatal("same origin request was rejected")
+	}
+
+	// 不支持 Hijack 的 ResponseWriter
+	r := New()
+	r.WS("/ws", func(conn *WSConn) {})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "WebSocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if got := wsAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("wsAcceptKey() = %q", got)
+	}
+
+	// 调用方传入的切片有剩余容量时 不能被改写
+	middlewares := make([]HandlerFunc, 1, 2)
+	middlewares[0] = func(c *Context) {}
+	r.WS("/ws2", func(conn *WSConn) {}, middlewares...)
+	if middlewares[:2][1] != nil {
+		t.Fatal("WS wrote into the caller's middleware slice")
+	}
+}
+
+func TestWebSocketCloseWhileReading(t *testing.T) {
+	r := New()
+	done := make(chan error, 1)
+	r.WS("/ws", func(conn *WSConn) {
+		// 处理器返回后 Close 与仍在读取的 goroutine 并发执行
+		go func() {
+			_, _, err := conn.ReadMessage()
+			done <- err
+		}()
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	conn, _ := dialWS(t, ts, "/ws", nil)
+	_, _, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseNormalClosure {
+		t.Fatalf("ReadMessage() error = %v, want close %d", err, CloseNormalClosure)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("reader should fail after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader was not unblocked by Close")
+	}
+}
@@ -0,0 +1,276 @@
+package gee
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// marshalYAML
+// @Description: 将数据编码为 YAML 只依赖标准库 覆盖 API 响应中常见的类型
+// @PS: 结构体字段使用 yaml 标签 格式为 `yaml:"name,omitempty"` 没有标签时使用小写的字段名 匿名结构体字段会被展开
+// @PS: map 的 key 按字符串排序 保证输出稳定 []byte 编码为 !!binary 的 base64 字符串
+// @param v
+// @return []byte
+// @return error
+func marshalYAML(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := encodeYAML(buf, reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlField 待输出的键值对
+type yamlField struct {
+	key   string
+	value reflect.Value
+}
+
+// encodeYAML 按缩进写入一个值 每一行都以 indent 个空格开头并以换行结尾
+func encodeYAML(buf *bytes.Buffer, v reflect.Value, indent int) error {
+	v = yamlIndirect(v)
+	pad := strings.Repeat(" ", indent)
+	if scalar, ok, err := yamlScalar(v); err != nil {
+		return err
+	} else if ok {
+		buf.WriteString(pad + scalar + "\n")
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Map, reflect.Struct:
+		fields, err := yamlFields(v)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			buf.WriteString(pad + "{}\n")
+			return nil
+		}
+		for _, field := range fields {
+			value := yamlIndirect(field.value)
+			scalar, ok, err := yamlScalar(value)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				scalar, ok = yamlEmpty(value)
+			}
+			if ok {
+				buf.WriteString(pad + field.key + ": " + scalar + "\n")
+				continue
+			}
+			buf.WriteString(pad + field.key + ":\n")
+			if err := encodeYAML(buf, value, indent+2); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			buf.WriteString(pad + "[]\n")
+			return nil
+		}
+		// 元素按 indent+2 缩进编码 再把第一行的缩进替换为 "- "
+		for i := 0; i < v.Len(); i++ {
+			elem := new(bytes.Buffer)
+			if err := encodeYAML(elem, v.Index(i), indent+2); err != nil {
+				return err
+			}
+			buf.WriteString(pad + "- ")
+			buf.Write(elem.Bytes()[indent+2:])
+		}
+	default:
+		return fmt.Errorf("gee: yaml: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// yamlIndirect 解引用指针和接口
+func yamlIndirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// yamlScalar 标量的 YAML 表示
+// @return bool 是否为标量
+func yamlScalar(v reflect.Value) (string, bool, error) {
+	if !v.IsValid() {
+		return "null", true, nil
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), true, nil
+	}
+	if v.Type() == durationType {
+		return quoteYAML(v.Interface().(time.Duration).String()), true, nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return "", false, err
+		}
+		return quoteYAML(string(text)), true, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return "", false, nil
+		}
+		if v.Len() == 0 {
+			return `!!binary ""`, true, nil
+		}
+		return "!!binary " + base64.StdEncoding.EncodeToString(v.Bytes()), true, nil
+	case reflect.String:
+		return quoteYAML(v.String()), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return ".nan", true, nil
+		case math.IsInf(f, 1):
+			return ".inf", true, nil
+		case math.IsInf(f, -1):
+			return "-.inf", true, nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, v.Type().Bits()), true, nil
+	}
+	return "", false, nil
+}
+
+// yamlEmpty 空的 map、结构体、切片在行内输出
+func yamlEmpty(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Len() == 0 {
+			return "{}", true
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return "[]", true
+		}
+	case reflect.Struct:
+		if fields, err := yamlFields(v); err == nil && len(fields) == 0 {
+			return "{}", true
+		}
+	}
+	return "", false
+}
+
+// yamlFields 获取 map 或结构体的全部键值对
+func yamlFields(v reflect.Value) ([]yamlField, error) {
+	var fields []yamlField
+	if v.Kind() == reflect.Map {
+		for _, key := range v.MapKeys() {
+			k, ok, err := yamlScalar(yamlIndirect(key))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("gee: yaml: unsupported map key type %s", key.Type())
+			}
+			fields = append(fields, yamlField{key: k, value: v.MapIndex(key)})
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].key < fields[j].key
+		})
+		return fields, nil
+	}
+
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+		value := v.Field(i)
+		// 匿名结构体字段展开到外层
+		if field.Anonymous && name == "" {
+			if inner := yamlIndirect(value); inner.IsValid() && inner.Kind() == reflect.Struct {
+				innerFields, err := yamlFields(inner)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, innerFields...)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if strings.Contains(opts, "omitempty") && value.IsZero() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields = append(fields, yamlField{key: quoteYAML(name), value: value})
+	}
+	return fields, nil
+}
+
+// yamlTimestampPattern 以日期开头的字符串会被解析为时间 例如 2024-01-01、2024-1-1 12:00:00
+var yamlTimestampPattern = regexp.MustCompile(`^[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}`)
+
+// quoteYAML 字符串可能被解析为其他类型或包含特殊字符时 使用双引号包裹
+func quoteYAML(s string) string {
+	if s == "" {
+		return `""`
+	}
+	switch strings.ToLower(s) {
+	case "~", "null", "true", "false", "yes", "no", "on", "off", "y", "n",
+		".inf", "+.inf", "-.inf", ".nan":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	// 0x1F、0o17、0b101、1_000 等形式的整数 超出范围时同样会被解析为数字
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		return strconv.Quote(s)
+	}
+	if yamlTimestampPattern.MatchString(s) {
+		return strconv.Quote(s)
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@` ") ||
+		strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f || r == '\u2028' || r == '\u2029' {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -61,7 +61,12 @@ func webHttpListen() {
 	r.SetFuncMap(template.FuncMap{
 		"FormatAsDate": FormatAsDate,
 	})
-	r.LoadHTMLGlob("templates/*")
+	// 每个页面由公共布局、局部模板以及页面自身的内容组成
+	for _, page := range []string{"arr.tmpl", "css.tmpl", "custom_func.tmpl"} {
+		if err := r.AddHTMLSet(page, "templates/layouts/base.tmpl", "templates/partials/*.tmpl", "templates/"+page); err != nil {
+			log.Fatal(err)
+		}
+	}
 	r.Static("/assets", "./static") // 指定静态资源路径
 
 	stu1 := &student{Name: "Bob", Age: 20}